@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/audit"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/config"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/credentials"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/zone"
+)
+
+// command is a CLI mode of the binary, run as "<binary> <name> [flags]".
+// Without a command the webhook server is started.
+type command struct {
+	summary string
+	run     func(args []string) error
+}
+
+var commands = map[string]command{
+	"snapshot": {"Save the records of Simply.com domains to a JSON file", runSnapshot},
+	"restore":  {"Restore Simply.com domains from a snapshot file", runRestore},
+	"export":   {"Write a Simply.com domain as a BIND zone file", runExport},
+	"import":   {"Make a Simply.com domain match a BIND zone file", runImport},
+	"sync":     {"Make Simply.com domains match a declarative YAML file", runSync},
+}
+
+// runCommand runs the named CLI command and exits
+func runCommand(name string, args []string) {
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+
+	if err := cmd.run(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// usage lists the available commands
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s [command] [flags]\n\nWithout a command the webhook server is started.\n\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(w, "Server flags:\n")
+	fmt.Fprintf(w, "  %-14s %s\n", "-config file", "YAML or JSON configuration file (default $CONFIG_FILE)")
+	fmt.Fprintf(w, "  %-14s %s\n", "-print-config", "Print the effective configuration with secrets redacted and exit")
+	fmt.Fprintf(w, "\nCommands:\n")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-10s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintf(w, "\nRun '%s <command> -h' for the flags of a command.\n", filepath.Base(os.Args[0]))
+}
+
+// newClientFromEnv creates a Simply.com client from SIMPLY_ACCOUNT_NAME and
+// SIMPLY_API_KEY, or their _FILE variants. With SIMPLY_ACCOUNT set, the
+// credentials of that account of SIMPLY_ACCOUNTS are used instead.
+func newClientFromEnv() (*simply.Client, error) {
+	source := credentials.FromEnv()
+	if account := os.Getenv("SIMPLY_ACCOUNT"); account != "" {
+		source = credentials.FromEnvPrefix(credentials.AccountPrefix(account))
+	}
+	accountName, apiKey, err := source.Load()
+	if err != nil {
+		return nil, err
+	}
+	return simply.NewClient(accountName, apiKey), nil
+}
+
+// auditLog records the changes made by a command in the audit log of the
+// webhook, so they can be traced like those made by ExternalDNS
+type auditLog struct {
+	sink  audit.Sink
+	batch string
+}
+
+// openAuditLog opens the audit sinks configured for the webhook, read from
+// the audit section of CONFIG_FILE and the environment. Every change made by
+// the command is recorded under one batch ID, starting with the command name.
+func openAuditLog(command string) (*auditLog, error) {
+	cfg, err := config.LoadAudit(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the audit configuration: %w", err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	sinks, err := openAuditSinks(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLog{
+		sink:  sinks,
+		batch: fmt.Sprintf("%s-%s", command, time.Now().UTC().Format("20060102T150405Z")),
+	}, nil
+}
+
+// record writes the result of a mutation to the audit log. Failures are
+// reported but do not stop the command, as the change has already been made.
+func (a *auditLog) record(m simply.Mutation, err error) {
+	if err := a.sink.Write(audit.NewEvent(a.batch, m, err)); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to write audit event for %s: %v\n", m.String(), err)
+	}
+}
+
+// Close writes the pending events and closes the audit sinks
+func (a *auditLog) Close() {
+	if err := a.sink.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to close audit log: %v\n", err)
+	}
+}
+
+// openAuditSinks opens the configured audit sinks. The file is written
+// synchronously, while HTTP events are queued so a slow endpoint never
+// delays a change.
+func openAuditSinks(cfg config.Audit, logger *slog.Logger) (audit.Multi, error) {
+	var sinks audit.Multi
+	if cfg.File != "" {
+		sink, err := audit.NewFileSink(cfg.File, int64(cfg.MaxSizeMB)*1024*1024, cfg.MaxBackups)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log %s: %w", cfg.File, err)
+		}
+		sinks = append(sinks, sink)
+	}
+	if cfg.HTTPURL != "" {
+		sinks = append(sinks, audit.NewAsync(audit.NewHTTPSink(cfg.HTTPURL, cfg.HTTPToken), audit.DefaultQueueSize, logger))
+	}
+	return sinks, nil
+}
+
+// splitDomains splits a comma-separated domain flag
+func splitDomains(s string) []string {
+	var domains []string
+	for _, d := range strings.Split(s, ",") {
+		d = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(d), "."))
+		if d != "" {
+			domains = append(domains, d)
+		}
+	}
+	return domains
+}
+
+// printPlan writes a human-readable plan for a domain
+func printPlan(w io.Writer, domain string, plan zone.Plan) {
+	creates, updates, deletes := plan.Counts()
+	fmt.Fprintf(w, "%s: %d to create, %d to update, %d to delete\n", domain, creates, updates, deletes)
+	for _, m := range plan {
+		switch m.Action {
+		case simply.ActionCreate:
+			fmt.Fprintf(w, "  + %s %s %s (ttl %d)\n", m.Record.Name, m.Record.Type, recordData(m.Record), m.Record.TTL)
+		case simply.ActionUpdate:
+			fmt.Fprintf(w, "  ~ %s %s %s (ttl %d) -> %s (ttl %d)\n", m.Record.Name, m.Record.Type, recordData(*m.Before), m.Before.TTL, recordData(m.Record), m.Record.TTL)
+		case simply.ActionDelete:
+			fmt.Fprintf(w, "  - %s %s %s (ttl %d)\n", m.Record.Name, m.Record.Type, recordData(m.Record), m.Record.TTL)
+		}
+	}
+}
+
+// recordData returns the data of a record, prefixed with its priority for MX and SRV
+func recordData(r simply.Record) string {
+	if r.HasPriority() {
+		return fmt.Sprintf("%d %s", r.Priority, r.Data)
+	}
+	return r.Data
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/audit"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/zone"
+)
+
+func TestCommandChangesAreAudited(t *testing.T) {
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "audit.log")
+
+	// The rest of the server configuration is invalid and must not matter
+	configFile := filepath.Join(dir, "config.yaml")
+	contents := "listen:\n  api: \"\"\nttl:\n  min: 1\naudit:\n  file: " + logFile + "\n"
+	if err := os.WriteFile(configFile, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", configFile)
+
+	// Simply.com accepts the create and rejects the delete
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			http.Error(w, `{"message":"record not found"}`, http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"status":200}`))
+	}))
+	defer api.Close()
+	client := simply.NewClient("S123456", "key")
+	client.BaseURL = api.URL + "/"
+
+	auditor, err := openAuditLog("import")
+	if err != nil {
+		t.Fatalf("openAuditLog() error = %v", err)
+	}
+	plan := zone.Plan{
+		{Action: simply.ActionCreate, Domain: "example.com", Record: simply.Record{Name: "www", Type: "A", Data: "192.0.2.1", TTL: 3600}},
+		{Action: simply.ActionDelete, Domain: "example.com", Record: simply.Record{ID: 7, Name: "old", Type: "A", Data: "192.0.2.2", TTL: 3600}},
+	}
+	applied, err := zone.Apply(client, plan, auditor.record)
+	if err == nil || applied != 1 {
+		t.Fatalf("zone.Apply() = %d, %v, want 1 and an error", applied, err)
+	}
+	auditor.Close()
+
+	file, err := os.Open(logFile)
+	if err != nil {
+		t.Fatalf("audit log not written: %v", err)
+	}
+	defer file.Close()
+
+	var events []audit.Event
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var e audit.Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("invalid audit line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, e)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("got %d audit events, want 2", len(events))
+	}
+	for i, want := range []struct{ action, outcome string }{
+		{simply.ActionCreate, audit.OutcomeSuccess},
+		{simply.ActionDelete, audit.OutcomeFailure},
+	} {
+		e := events[i]
+		if e.Action != want.action || e.Outcome != want.outcome || e.Domain != "example.com" {
+			t.Errorf("event %d = %s %s in %s, want %s %s", i, e.Action, e.Outcome, e.Domain, want.action, want.outcome)
+		}
+		if !strings.HasPrefix(e.Batch, "import-") || e.Batch != events[0].Batch {
+			t.Errorf("event %d batch = %q, want one import- batch", i, e.Batch)
+		}
+	}
+}
+
+func TestOpenAuditLogFromEnvironment(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "audit.log")
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("AUDIT_LOG_FILE", logFile)
+
+	auditor, err := openAuditLog("sync")
+	if err != nil {
+		t.Fatalf("openAuditLog() error = %v", err)
+	}
+	auditor.record(simply.Mutation{Action: simply.ActionCreate, Domain: "example.com", Record: simply.Record{Name: "www", Type: "A"}}, nil)
+	auditor.Close()
+
+	data, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("audit log not written: %v", err)
+	}
+	if !strings.Contains(string(data), `"batch":"sync-`) {
+		t.Errorf("audit log = %s, want a sync batch", data)
+	}
+}
+
+func TestOpenAuditLogRejectsInvalidAuditSettings(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("AUDIT_LOG_MAX_SIZE", "large")
+
+	if _, err := openAuditLog("restore"); err == nil {
+		t.Fatal("openAuditLog() succeeded with an invalid AUDIT_LOG_MAX_SIZE")
+	}
+}
@@ -1,141 +1,420 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/auth"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/certs"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/config"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/credentials"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/domains"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/drift"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/journal"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/metrics"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/notify"
 	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
 	"github.com/uozalp/external-dns-simply-webhook/pkg/webhook"
 )
 
-// corsMiddleware adds CORS headers to all responses
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Accept")
-		w.Header().Set("Access-Control-Max-Age", "3600")
-
-		// Handle preflight requests
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
+// corsMiddleware adds CORS headers for the allowed origins and rejects
+// requests sent from any other origin. Requests without an Origin header,
+// such as those from ExternalDNS, are not affected.
+func corsMiddleware(allowedOrigins []string, logger *slog.Logger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if origin := r.Header.Get("Origin"); origin != "" {
+				allowOrigin, ok := matchOrigin(allowedOrigins, origin)
+				if !ok {
+					logger.Warn("Rejected request from disallowed origin",
+						"origin", origin,
+						"method", r.Method,
+						"path", r.URL.Path,
+						"remoteAddr", r.RemoteAddr,
+					)
+					http.Error(w, "Origin not allowed", http.StatusForbidden)
+					return
+				}
+				w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+				w.Header().Add("Vary", "Origin")
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Accept")
+				w.Header().Set("Access-Control-Max-Age", "3600")
+			}
 
-		next.ServeHTTP(w, r)
-	})
+			// Handle preflight requests
+			if r.Method == "OPTIONS" {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// matchOrigin returns the Access-Control-Allow-Origin value for origin, if it
+// is allowed
+func matchOrigin(allowedOrigins []string, origin string) (string, bool) {
+	for _, allowed := range allowedOrigins {
+		if allowed == "*" {
+			return "*", true
+		}
+		if strings.EqualFold(allowed, origin) {
+			return origin, true
+		}
+	}
+	return "", false
 }
 
 func main() {
-	// Configure logger
-	logLevel := os.Getenv("LOG_LEVEL")
-	var level slog.Level
-	switch strings.ToLower(logLevel) {
-	case "debug":
-		level = slog.LevelDebug
-	case "info", "":
-		level = slog.LevelInfo
-	case "warn", "warning":
-		level = slog.LevelWarn
-	case "error":
-		level = slog.LevelError
-	default:
-		level = slog.LevelInfo
+	if len(os.Args) > 1 {
+		if os.Args[1] == "help" || os.Args[1] == "-h" || os.Args[1] == "--help" {
+			usage(os.Stdout)
+			return
+		}
+		if !strings.HasPrefix(os.Args[1], "-") {
+			runCommand(os.Args[1], os.Args[2:])
+		}
+	}
+
+	// Server flags; every option can also be set in the config file or the
+	// environment
+	flags := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ExitOnError)
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "YAML or JSON configuration file")
+	printConfig := flags.Bool("print-config", false, "print the effective configuration with secrets redacted and exit")
+	flags.Parse(os.Args[1:])
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *printConfig {
+		if err := cfg.Redact().Write(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
 	}
 
+	// Configure logger; the level can be changed by reloading the config file
+	var logLevel slog.LevelVar
+	logLevel.Set(cfg.LogLevel())
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level: level,
+		Level: &logLevel,
 	}))
+	if *configFile != "" {
+		logger.Info("Loaded configuration", "file", *configFile)
+	}
 
-	// Get configuration from environment
-	accountName := os.Getenv("SIMPLY_ACCOUNT_NAME")
-	if accountName == "" {
-		logger.Error("SIMPLY_ACCOUNT_NAME environment variable is required")
-		os.Exit(1)
+	// Create a client for each Simply.com account
+	var accounts []simply.Account
+	var accountNames []string
+	for _, account := range cfg.Accounts {
+		accountName, apiKey, err := account.CredentialSource().Load()
+		if err != nil {
+			logger.Error("Invalid Simply.com credentials", "account", account.Name, "error", err)
+			os.Exit(1)
+		}
+		accounts = append(accounts, simply.Account{Name: account.Name, Client: simply.NewClient(accountName, apiKey)})
+		accountNames = append(accountNames, account.Name)
+	}
+
+	// Domain filter, safety limits, protected records and TTLs; these can be
+	// changed by reloading the config file
+	policy := cfg.Policy()
+	if policy.Limits.Override {
+		logger.Warn("Mass changes are allowed, safety limits will only be logged")
+	}
+	if len(policy.Protected) > 0 {
+		logger.Info("Protecting records from modification", "count", len(policy.Protected), "records", policy.Protected, "hidden", policy.HideProtected)
+	}
+
+	// Optional TLS, with client certificates verified against a CA for mTLS
+	var certReloader *certs.Reloader
+	if cfg.TLS.CertFile != "" {
+		certReloader, err = certs.NewReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile, cfg.TLS.ClientCAFile, logger)
+		if err != nil {
+			logger.Error("Failed to load TLS certificate", "error", err)
+			os.Exit(1)
+		}
+		// Without required client certificates, probes without one are still
+		// served; the API authenticator rejects them on protected routes
+		certReloader.RequireClientCert = cfg.TLS.RequireClientCert
+		certReloader.Interval = time.Duration(cfg.TLS.ReloadInterval)
 	}
 
-	apiKey := os.Getenv("SIMPLY_API_KEY")
-	if apiKey == "" {
-		logger.Error("SIMPLY_API_KEY environment variable is required")
+	// Authenticate everything except the probes with a bearer token and/or a
+	// client certificate
+	apiToken, err := auth.LoadToken(cfg.Auth.Token, cfg.Auth.TokenFile)
+	if err != nil {
+		logger.Error("Invalid API token", "error", err)
 		os.Exit(1)
 	}
+	authenticator := &auth.Authenticator{
+		Token:       apiToken,
+		ClientCerts: cfg.TLS.ClientCAFile != "",
+		Exempt:      []string{"/healthz", "/livez", "/readyz"},
+		Logger:      logger,
+	}
+	if !authenticator.Enabled() {
+		logger.Warn("API authentication is disabled, anything that can reach the server can change DNS records")
+	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8888"
+	// Route every request to the account owning the zone
+	client := simply.NewAccounts(logger, accounts...)
+	if len(accounts) > 1 {
+		logger.Info("Serving several Simply.com accounts", "accounts", accountNames)
 	}
 
-	// Create Simply.com client
-	client := simply.NewClient(accountName, apiKey)
+	if !policy.Filter.IsConfigured() {
+		logger.Info("No domain filter set, managing all Simply.com domains")
+	}
+
+	// Create webhook handler; it reports not-ready until domains are discovered
+	handler := webhook.NewHandler(client, logger, nil)
+	handler.SetPolicy(policy)
+	handler.HealthCacheTTL = time.Duration(cfg.HealthCacheTTL)
+	handler.ZoneLockTimeout = time.Duration(cfg.ZoneLockTimeout)
 
-	// Fetch all domains managed by Simply.com
-	logger.Info("Fetching domains from Simply.com.")
-	allSimplyDomains, err := client.ListDomains()
+	// Report batches interrupted by a previous crash before accepting new ones
+	if journalDir := cfg.Journal.Dir; journalDir != "" {
+		j, err := journal.Open(journalDir)
+		if err != nil {
+			logger.Error("Failed to open journal", "dir", journalDir, "error", err)
+			os.Exit(1)
+		}
+
+		incomplete, err := j.Recover()
+		if err != nil {
+			logger.Error("Failed to recover journal", "dir", journalDir, "error", err)
+			os.Exit(1)
+		}
+		for _, b := range incomplete {
+			logger.Warn("Found batch interrupted by a previous crash",
+				"batch", b.Batch,
+				"started", b.Started,
+				"done", len(b.Done),
+				"failed", len(b.Failed),
+				"pending", len(b.Pending),
+				"file", b.File,
+			)
+			for _, m := range b.Pending {
+				logger.Warn("Mutation not confirmed before the crash", "batch", b.Batch, "mutation", m.String())
+			}
+		}
+
+		handler.Journal = j
+		logger.Info("Journaling batches", "dir", journalDir)
+	}
+
+	// Record every mutation sent to Simply.com in the audit log
+	sinks, err := openAuditSinks(cfg.Audit, logger)
 	if err != nil {
-		logger.Error("Failed to fetch domains from Simply.com", "error", err)
+		logger.Error("Failed to open audit log", "error", err)
 		os.Exit(1)
 	}
-	logger.Info("Found domains in Simply.com", "count", len(allSimplyDomains), "domains", allSimplyDomains)
-
-	// Get domain filter from environment (optional)
-	domainFilter := os.Getenv("DOMAIN_FILTER")
-	var finalDomains []string
+	if cfg.Audit.File != "" {
+		logger.Info("Writing audit log", "file", cfg.Audit.File, "maxSizeMB", cfg.Audit.MaxSizeMB, "maxBackups", cfg.Audit.MaxBackups)
+	}
+	if cfg.Audit.HTTPURL != "" {
+		logger.Info("Sending audit events", "url", config.RedactURL(cfg.Audit.HTTPURL))
+	}
+	if len(sinks) > 0 {
+		handler.Audit = sinks
+	}
 
-	if domainFilter != "" {
-		// User specified domain filter - validate against Simply.com domains
-		requestedDomains := strings.Split(domainFilter, ",")
-		simplyDomainsMap := make(map[string]bool)
-		for _, domain := range allSimplyDomains {
-			simplyDomainsMap[domain] = true
+	// Send a summary of every batch to the configured notification endpoints
+	var notifier *notify.Notifier
+	if len(cfg.Notify.URLs) > 0 {
+		notifier = notify.NewNotifier(cfg.Notify.URLs, logger)
+		notifier.Secret = cfg.Notify.HMACSecret
+		notifier.Retries = cfg.Notify.Retries
+		notifier.HTTPClient.Timeout = time.Duration(cfg.Notify.Timeout)
+		if cfg.Notify.TemplateFile != "" {
+			if notifier.Template, err = notify.LoadTemplate(cfg.Notify.TemplateFile); err != nil {
+				logger.Error("Invalid notification template", "error", err)
+				os.Exit(1)
+			}
 		}
+		handler.Notifier = notifier
+		logger.Info("Sending batch notifications", "urls", len(cfg.Notify.URLs), "signed", notifier.Secret != "")
+	}
+
+	// Discover domains in the background, retrying with backoff while
+	// Simply.com is unreachable, then periodically re-discover them so new
+	// zones are picked up without a restart
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-		for _, domain := range requestedDomains {
-			domain = strings.TrimSpace(domain)
-			if simplyDomainsMap[domain] {
-				finalDomains = append(finalDomains, domain)
-				logger.Info("Domain filter: domain is managed by Simply.com", "domain", domain)
-			} else {
-				logger.Error("Domain filter: domain is NOT managed by Simply.com - skipping", "domain", domain)
+	refresher := domains.NewRefresher(client, policy.Filter, time.Duration(cfg.Domains.RefreshInterval), logger, handler.SetDomains)
+	go refresher.Run(ctx)
+
+	// Apply changes to the config file without a restart; an invalid file is
+	// logged and the running configuration kept
+	if *configFile != "" {
+		watcher, err := config.NewWatcher(*configFile, cfg, logger, func(next *config.Config) error {
+			policy := next.Policy()
+			// Narrow the managed domains to the new filter before the policy
+			// takes effect, so no batch sees the new policy with old domains.
+			// A filter matching no domain rejects the whole reload.
+			if err := refresher.SetFilter(policy.Filter); err != nil {
+				return err
 			}
+			logLevel.Set(next.LogLevel())
+			handler.SetPolicy(policy)
+			return nil
+		})
+		if err != nil {
+			logger.Error("Failed to watch config file", "file", *configFile, "error", err)
+			os.Exit(1)
 		}
+		go watcher.Run(ctx)
+	}
 
-		if len(finalDomains) == 0 {
-			logger.Error("No valid domains found in DOMAIN_FILTER")
+	// Compare live zones with what the webhook applied to spot out-of-band edits
+	var detector *drift.Detector
+	if cfg.Drift.Interval > 0 {
+		tracker, err := drift.NewTracker(cfg.Drift.StateFile)
+		if err != nil {
+			logger.Error("Failed to load drift state", "error", err)
 			os.Exit(1)
 		}
-		logger.Info("Managing filtered domains", "count", len(finalDomains), "domains", finalDomains)
-	} else {
-		// No domain filter - manage all Simply.com domains
-		finalDomains = allSimplyDomains
-		logger.Info("No domain filter set, managing all Simply.com domains", "count", len(finalDomains))
+		handler.Drift = tracker
+		detector = drift.NewDetector(tracker, client, time.Duration(cfg.Drift.Interval), logger)
+		detector.LockZone = handler.LockZone
+		go detector.Run(ctx)
+		logger.Info("Detecting drift", "interval", time.Duration(cfg.Drift.Interval).String(), "stateFile", cfg.Drift.StateFile)
 	}
 
-	// Create webhook handler with validated domains
-	handler := webhook.NewHandler(client, logger, finalDomains)
+	// Pick up rotated credentials without a restart and report when
+	// Simply.com rejects them
+	for i, account := range accounts {
+		reloader := credentials.NewReloader(account.Name, cfg.Accounts[i].CredentialSource(), account.Client, time.Duration(cfg.CredentialsReloadInterval), logger)
+		go reloader.Run(ctx)
+	}
+
+	// Pick up rotated certificates without a restart
+	if certReloader != nil {
+		go certReloader.Run(ctx)
+	}
 
-	// Setup router
-	router := mux.NewRouter()
-	router.HandleFunc("/", handler.Negotiate).Methods("GET")
-	router.HandleFunc("/healthz", handler.Healthz).Methods("GET")
-	router.HandleFunc("/records", handler.GetRecords).Methods("GET")
-	router.HandleFunc("/records", handler.ApplyChanges).Methods("POST")
-	router.HandleFunc("/records", func(w http.ResponseWriter, r *http.Request) {
+	// Setup the provider API router, used by ExternalDNS
+	apiRouter := mux.NewRouter()
+	apiRouter.HandleFunc("/", handler.Negotiate).Methods("GET")
+	apiRouter.HandleFunc("/records", handler.GetRecords).Methods("GET")
+	apiRouter.HandleFunc("/records", handler.ApplyChanges).Methods("POST")
+	apiRouter.HandleFunc("/records", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNoContent)
 	}).Methods("OPTIONS")
-	router.HandleFunc("/adjustendpoints", handler.AdjustEndpoints).Methods("POST")
+	apiRouter.HandleFunc("/adjustendpoints", handler.AdjustEndpoints).Methods("POST")
+
+	// Setup the health, metrics and admin router; when both listen on the
+	// same address, all routes are served by one router
+	adminRouter := mux.NewRouter()
+	if cfg.Listen.Metrics == cfg.Listen.API {
+		adminRouter = apiRouter
+	}
+	adminRouter.HandleFunc("/healthz", handler.Healthz).Methods("GET")
+	adminRouter.HandleFunc("/livez", handler.Livez).Methods("GET")
+	adminRouter.HandleFunc("/readyz", handler.Readyz).Methods("GET")
+	adminRouter.HandleFunc("/health", handler.Health).Methods("GET")
+	adminRouter.Handle("/metrics", metrics.Handler()).Methods("GET")
+	if detector != nil {
+		adminRouter.Handle("/drift", detector).Methods("GET")
+	}
+
+	servers := []*http.Server{{Addr: cfg.Listen.API, Handler: apiRouter}}
+	routes := []string{"api,admin"}
+	if adminRouter != apiRouter {
+		servers = append(servers, &http.Server{Addr: cfg.Listen.Metrics, Handler: adminRouter})
+		routes = []string{"api", "admin"}
+	}
 
-	// Apply CORS middleware to all routes
-	router.Use(corsMiddleware)
+	serverErr := make(chan error, len(servers))
+	for i, server := range servers {
+		// Apply CORS and authentication middleware to all routes
+		router := server.Handler.(*mux.Router)
+		router.Use(corsMiddleware(cfg.Auth.CORSAllowedOrigins, logger))
+		router.Use(authenticator.Middleware)
 
-	// Start server
-	addr := fmt.Sprintf(":%s", port)
-	logger.Info("Starting server", "addr", addr)
-	if err := http.ListenAndServe(addr, router); err != nil {
+		if certReloader != nil {
+			server.TLSConfig = certReloader.TLSConfig()
+		}
+
+		go func(server *http.Server, routes string) {
+			logger.Info("Starting server", "addr", server.Addr, "routes", routes, "tls", certReloader != nil, "auth", authenticator.Enabled())
+			if certReloader != nil {
+				// The certificate comes from the TLS config, not the files
+				serverErr <- server.ListenAndServeTLS("", "")
+				return
+			}
+			serverErr <- server.ListenAndServe()
+		}(server, routes[i])
+	}
+
+	select {
+	case err := <-serverErr:
 		logger.Error("Failed to start server", "error", err)
 		os.Exit(1)
+	case <-ctx.Done():
 	}
+
+	// Drain in-flight requests so an ApplyChanges is not cut off halfway
+	logger.Info("Shutting down, draining in-flight requests", "timeout", time.Duration(cfg.ShutdownDrainTimeout).String())
+	handler.BeginShutdown()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownDrainTimeout))
+	defer cancel()
+
+	// Stop the API first; health and metrics stay available while it drains
+	exitCode := 0
+	if err := servers[0].Shutdown(shutdownCtx); err != nil {
+		logger.Error("Drain timeout exceeded, in-flight work was cut off", "error", err)
+		for _, b := range handler.InFlight() {
+			logger.Error("Interrupted ApplyChanges batch", "batch", b.ID, "started", b.Started, "completed", b.Completed, "total", b.Total, "remaining", b.Remaining)
+		}
+		exitCode = 1
+	}
+
+	for _, server := range servers[1:] {
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.Error("Failed to stop server", "addr", server.Addr, "error", err)
+		}
+	}
+
+	// The drain may have used up shutdownCtx, so pending notifications get
+	// their own budget of one notification timeout
+	if notifier != nil {
+		flushTimeout := time.Duration(cfg.Notify.Timeout)
+		if flushTimeout <= 0 {
+			flushTimeout = notify.DefaultTimeout
+		}
+		flushCtx, cancelFlush := context.WithTimeout(context.Background(), flushTimeout)
+		if err := notifier.Close(flushCtx); err != nil {
+			logger.Error("Failed to deliver pending notifications", "error", err)
+		}
+		cancelFlush()
+	}
+
+	// Close the audit sinks explicitly, as os.Exit skips deferred calls
+	if len(sinks) > 0 {
+		if err := sinks.Close(); err != nil {
+			logger.Error("Failed to close audit log", "error", err)
+		}
+	}
+
+	logger.Info("Server stopped")
+	os.Exit(exitCode)
 }
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		allowed    []string
+		method     string
+		origin     string
+		want       int
+		wantOrigin string
+	}{
+		{name: "no origin header", allowed: nil, want: http.StatusOK},
+		{name: "no origins allowed", allowed: nil, origin: "https://evil.example", want: http.StatusForbidden},
+		{name: "disallowed origin", allowed: []string{"https://ui.example.com"}, origin: "https://evil.example", want: http.StatusForbidden},
+		{name: "allowed origin", allowed: []string{"https://ui.example.com"}, origin: "https://UI.example.com", want: http.StatusOK, wantOrigin: "https://UI.example.com"},
+		{name: "wildcard", allowed: []string{"*"}, origin: "https://ui.example.com", want: http.StatusOK, wantOrigin: "*"},
+		{name: "preflight", allowed: []string{"https://ui.example.com"}, method: http.MethodOptions, origin: "https://ui.example.com", want: http.StatusNoContent, wantOrigin: "https://ui.example.com"},
+		{name: "disallowed preflight", allowed: []string{"https://ui.example.com"}, method: http.MethodOptions, origin: "https://evil.example", want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			handler := corsMiddleware(tt.allowed, logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			req := httptest.NewRequest(method, "/records", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/snapshot"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/zone"
+)
+
+// runSnapshot saves all records of the selected domains to a snapshot file
+func runSnapshot(args []string) error {
+	fs := flag.NewFlagSet("snapshot", flag.ContinueOnError)
+	output := fs.String("output", "", "snapshot file to write (required)")
+	domainList := fs.String("domains", "", "comma-separated domains to snapshot (default: all Simply.com domains)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *output == "" {
+		return fmt.Errorf("-output is required")
+	}
+
+	client, err := newClientFromEnv()
+	if err != nil {
+		return err
+	}
+
+	domains := splitDomains(*domainList)
+	if len(domains) == 0 {
+		if domains, err = client.ListDomains(); err != nil {
+			return err
+		}
+	}
+
+	snap, err := snapshot.Take(client, domains)
+	if err != nil {
+		return err
+	}
+	if err := snap.Save(*output); err != nil {
+		return err
+	}
+
+	for _, z := range snap.Zones {
+		fmt.Printf("%s: %d records\n", z.Domain, len(z.Records))
+	}
+	fmt.Printf("Snapshot of %d domains written to %s\n", len(snap.Zones), *output)
+	return nil
+}
+
+// runRestore makes the selected domains match a snapshot by applying the
+// difference between the snapshot and the live records
+func runRestore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	input := fs.String("input", "", "snapshot file to restore from (required)")
+	domainList := fs.String("domains", "", "comma-separated domains to restore (default: all domains in the snapshot)")
+	dryRun := fs.Bool("dry-run", false, "print the changes without applying them")
+	noDelete := fs.Bool("no-delete", false, "keep live records that are not in the snapshot")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *input == "" {
+		return fmt.Errorf("-input is required")
+	}
+
+	snap, err := snapshot.Load(*input)
+	if err != nil {
+		return err
+	}
+
+	client, err := newClientFromEnv()
+	if err != nil {
+		return err
+	}
+
+	var auditor *auditLog
+	if !*dryRun {
+		if auditor, err = openAuditLog("restore"); err != nil {
+			return err
+		}
+		defer auditor.Close()
+	}
+
+	domains := splitDomains(*domainList)
+	if len(domains) == 0 {
+		for _, z := range snap.Zones {
+			domains = append(domains, z.Domain)
+		}
+	}
+
+	fmt.Printf("Restoring snapshot taken %s of account %s\n", snap.Created.Format("2006-01-02 15:04:05 MST"), snap.Account)
+
+	for _, domain := range domains {
+		z, ok := snap.Zone(domain)
+		if !ok {
+			return fmt.Errorf("snapshot does not contain domain %s", domain)
+		}
+
+		current, err := client.ListRecords(domain)
+		if err != nil {
+			return err
+		}
+
+		plan := zone.Diff(domain, current, z.Records, zone.Options{NoDelete: *noDelete})
+		printPlan(os.Stdout, domain, plan)
+		if *dryRun || len(plan) == 0 {
+			continue
+		}
+
+		applied, err := zone.Apply(client, plan, auditor.record)
+		if err != nil {
+			return fmt.Errorf("restore of %s stopped after %d of %d changes: %w", domain, applied, len(plan), err)
+		}
+		fmt.Printf("%s: applied %d changes\n", domain, applied)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/zone"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/zonesync"
+)
+
+// runSync makes Simply.com zones match a declarative YAML file, leaving
+// records owned by ExternalDNS alone
+func runSync(args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ContinueOnError)
+	file := fs.String("file", "", "YAML file describing the desired records (required)")
+	dryRun := fs.Bool("dry-run", false, "print the changes without applying them")
+	yes := fs.Bool("yes", false, "apply the changes without asking for confirmation")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return fmt.Errorf("-file is required")
+	}
+
+	config, err := zonesync.Load(*file)
+	if err != nil {
+		return err
+	}
+
+	client, err := newClientFromEnv()
+	if err != nil {
+		return err
+	}
+
+	plans, err := zonesync.Plan(client, config)
+	if err != nil {
+		return err
+	}
+
+	total := 0
+	for _, p := range plans {
+		printPlan(os.Stdout, p.Domain, p.Plan)
+		for _, r := range p.Conflicts {
+			fmt.Printf("  ! %s %s %s skipped: name and type are managed by ExternalDNS\n", r.Name, r.Type, r.Data)
+		}
+		total += len(p.Plan)
+	}
+
+	if total == 0 {
+		fmt.Println("Everything is in sync.")
+		return nil
+	}
+	if *dryRun {
+		return nil
+	}
+	if !*yes && !confirm(fmt.Sprintf("Apply %d changes?", total)) {
+		fmt.Println("Aborted, nothing was changed.")
+		return nil
+	}
+
+	auditor, err := openAuditLog("sync")
+	if err != nil {
+		return err
+	}
+	defer auditor.Close()
+
+	for _, p := range plans {
+		if len(p.Plan) == 0 {
+			continue
+		}
+		applied, err := zone.Apply(client, p.Plan, auditor.record)
+		if err != nil {
+			return fmt.Errorf("sync of %s stopped after %d of %d changes: %w", p.Domain, applied, len(p.Plan), err)
+		}
+		fmt.Printf("%s: applied %d changes\n", p.Domain, applied)
+	}
+	return nil
+}
+
+// confirm asks a yes/no question on the terminal, defaulting to no
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
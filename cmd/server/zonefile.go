@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/zone"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/zonefile"
+)
+
+// runExport writes the records of a domain as a BIND zone file
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	domain := fs.String("domain", "", "domain to export (required)")
+	output := fs.String("output", "", "zone file to write (default: standard output)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *domain == "" {
+		return fmt.Errorf("-domain is required")
+	}
+
+	client, err := newClientFromEnv()
+	if err != nil {
+		return err
+	}
+
+	records, err := client.ListRecords(*domain)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create zone file: %w", err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	if err := zonefile.Write(w, *domain, records); err != nil {
+		return err
+	}
+	if *output != "" {
+		fmt.Fprintf(os.Stderr, "Exported %d records of %s to %s\n", len(records), *domain, *output)
+	}
+	return nil
+}
+
+// runImport makes a domain match a BIND zone file. SOA records and NS
+// records at the apex are left alone, since Simply.com manages them.
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	domain := fs.String("domain", "", "domain to import into (required)")
+	input := fs.String("input", "", "zone file to read (required)")
+	dryRun := fs.Bool("dry-run", false, "print the changes without applying them")
+	noDelete := fs.Bool("no-delete", false, "keep live records that are not in the zone file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *domain == "" || *input == "" {
+		return fmt.Errorf("-domain and -input are required")
+	}
+
+	file, err := os.Open(*input)
+	if err != nil {
+		return fmt.Errorf("failed to open zone file: %w", err)
+	}
+	defer file.Close()
+
+	desired, err := zonefile.Parse(file, *domain)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", *input, err)
+	}
+
+	client, err := newClientFromEnv()
+	if err != nil {
+		return err
+	}
+
+	current, err := client.ListRecords(*domain)
+	if err != nil {
+		return err
+	}
+
+	plan := zone.Diff(*domain, current, desired, zone.Options{
+		NoDelete: *noDelete,
+		Skip: func(r simply.Record) bool {
+			return strings.EqualFold(r.Type, "NS") && zone.RelativeName(r.Name, *domain) == "@"
+		},
+	})
+	printPlan(os.Stdout, *domain, plan)
+	if *dryRun || len(plan) == 0 {
+		return nil
+	}
+
+	auditor, err := openAuditLog("import")
+	if err != nil {
+		return err
+	}
+	defer auditor.Close()
+
+	applied, err := zone.Apply(client, plan, auditor.record)
+	if err != nil {
+		return fmt.Errorf("import of %s stopped after %d of %d changes: %w", *domain, applied, len(plan), err)
+	}
+	fmt.Printf("%s: applied %d changes\n", *domain, applied)
+	return nil
+}
@@ -0,0 +1,103 @@
+package audit
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/metrics"
+)
+
+const (
+	// DefaultQueueSize bounds the events waiting for a slow sink
+	DefaultQueueSize = 1000
+	// DefaultDrainTimeout bounds how long Close waits for queued events
+	DefaultDrainTimeout = 10 * time.Second
+)
+
+// ErrQueueFull is returned by Async.Write when the event had to be dropped
+var ErrQueueFull = errors.New("audit queue is full, event dropped")
+
+var queuedEvents = metrics.NewCounterVec(
+	"simply_webhook_audit_queue_events_total",
+	"Number of audit events handled by asynchronous sinks by result (written, failed, dropped).",
+	"result",
+)
+
+// Async writes events to a sink in the background, so a slow sink such as an
+// HTTP collector never delays a mutation. Events are queued up to a bound;
+// when the queue is full they are dropped and Write reports it.
+type Async struct {
+	Sink         Sink
+	DrainTimeout time.Duration
+	Logger       *slog.Logger
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan Event
+	done   chan struct{}
+}
+
+// NewAsync starts writing the events queued for sink in the background
+func NewAsync(sink Sink, size int, logger *slog.Logger) *Async {
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+	a := &Async{
+		Sink:         sink,
+		DrainTimeout: DefaultDrainTimeout,
+		Logger:       logger,
+		queue:        make(chan Event, size),
+		done:         make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// Write queues the event without waiting for the sink
+func (a *Async) Write(e Event) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return errors.New("audit sink is closed")
+	}
+
+	select {
+	case a.queue <- e:
+		return nil
+	default:
+		queuedEvents.Inc("dropped")
+		return ErrQueueFull
+	}
+}
+
+func (a *Async) run() {
+	defer close(a.done)
+	for e := range a.queue {
+		if err := a.Sink.Write(e); err != nil {
+			queuedEvents.Inc("failed")
+			a.Logger.Error("Failed to write audit event", "batch", e.Batch, "action", e.Action, "domain", e.Domain, "error", err)
+			continue
+		}
+		queuedEvents.Inc("written")
+	}
+}
+
+// Close stops accepting events, waits up to DrainTimeout for the queued ones
+// to be written and closes the sink
+func (a *Async) Close() error {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.queue)
+	}
+	a.mu.Unlock()
+
+	select {
+	case <-a.done:
+	case <-time.After(a.DrainTimeout):
+		a.Logger.Error("Timed out writing queued audit events", "pending", len(a.queue))
+	}
+	return a.Sink.Close()
+}
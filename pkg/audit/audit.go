@@ -0,0 +1,80 @@
+package audit
+
+import (
+	"errors"
+	"time"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
+)
+
+// Outcomes of an audited mutation
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Event records a single mutation sent to Simply.com
+type Event struct {
+	Time     time.Time      `json:"time"`
+	Batch    string         `json:"batch"`
+	Action   string         `json:"action"`
+	Domain   string         `json:"domain"`
+	RecordID int            `json:"recordId,omitempty"`
+	Before   *simply.Record `json:"before,omitempty"`
+	After    *simply.Record `json:"after,omitempty"`
+	Outcome  string         `json:"outcome"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// NewEvent builds the audit event of a mutation and its result
+func NewEvent(batch string, m simply.Mutation, err error) Event {
+	e := Event{
+		Time:     time.Now().UTC(),
+		Batch:    batch,
+		Action:   m.Action,
+		Domain:   m.Domain,
+		RecordID: m.Record.ID,
+		Before:   m.Before,
+		Outcome:  OutcomeSuccess,
+	}
+	if m.Action != simply.ActionDelete {
+		after := m.Record
+		e.After = &after
+	}
+	if err != nil {
+		e.Outcome = OutcomeFailure
+		e.Error = err.Error()
+	}
+	return e
+}
+
+// Sink stores audit events
+type Sink interface {
+	Write(Event) error
+	Close() error
+}
+
+// Multi writes every event to all of its sinks
+type Multi []Sink
+
+// Write writes the event to every sink, returning the combined errors
+func (m Multi) Write(e Event) error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Write(e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes every sink
+func (m Multi) Close() error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
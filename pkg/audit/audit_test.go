@@ -0,0 +1,211 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
+)
+
+func testEvent(batch string) Event {
+	m := simply.Mutation{
+		Action: simply.ActionUpdate,
+		Domain: "example.com",
+		Record: simply.Record{ID: 7, Name: "www", Type: "A", Data: "192.0.2.2", TTL: 3600},
+		Before: &simply.Record{ID: 7, Name: "www", Type: "A", Data: "192.0.2.1", TTL: 3600},
+	}
+	return NewEvent(batch, m, nil)
+}
+
+func readEvents(t *testing.T, path string) []Event {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("invalid audit line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestNewEvent(t *testing.T) {
+	e := testEvent("batch-1")
+	if e.Outcome != OutcomeSuccess || e.Error != "" || e.RecordID != 7 || e.Before.Data != "192.0.2.1" || e.After.Data != "192.0.2.2" {
+		t.Errorf("NewEvent() = %+v", e)
+	}
+
+	deleted := NewEvent("batch-1", simply.Mutation{Action: simply.ActionDelete, Domain: "example.com", Record: simply.Record{ID: 7}}, errors.New("not found"))
+	if deleted.After != nil || deleted.Outcome != OutcomeFailure || deleted.Error != "not found" {
+		t.Errorf("NewEvent() of a failed delete = %+v", deleted)
+	}
+}
+
+func TestFileSinkRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	line, _ := json.Marshal(testEvent("batch-0"))
+
+	// Room for two events per file, keeping two backups
+	sink, err := NewFileSink(path, int64(2*(len(line)+1)), 2)
+	if err != nil {
+		t.Fatalf("NewFileSink() error = %v", err)
+	}
+	for i := 0; i < 7; i++ {
+		if err := sink.Write(testEvent(fmt.Sprintf("batch-%d", i))); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	for file, want := range map[string][]string{
+		path:        {"batch-6"},
+		path + ".1": {"batch-4", "batch-5"},
+		path + ".2": {"batch-2", "batch-3"},
+	} {
+		var got []string
+		for _, e := range readEvents(t, file) {
+			got = append(got, e.Batch)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s = %v, want %v", filepath.Base(file), got, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("more backups kept than configured: %v", err)
+	}
+
+	// Reopening appends to the existing file
+	sink, err = NewFileSink(path, 0, 0)
+	if err != nil {
+		t.Fatalf("NewFileSink() error = %v", err)
+	}
+	sink.Write(testEvent("batch-7"))
+	sink.Close()
+	if events := readEvents(t, path); len(events) != 2 {
+		t.Errorf("reopened audit log has %d events, want 2", len(events))
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	var received []Event
+	var auth string
+	status := http.StatusAccepted
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		var e Event
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			t.Errorf("invalid event: %v", err)
+		}
+		received = append(received, e)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink := NewHTTPSink(server.URL, "audit-token")
+	if err := sink.Write(testEvent("batch-1")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if auth != "Bearer audit-token" {
+		t.Errorf("Authorization = %q", auth)
+	}
+	if len(received) != 1 || received[0].Batch != "batch-1" || received[0].Domain != "example.com" {
+		t.Errorf("received %+v", received)
+	}
+
+	status = http.StatusInternalServerError
+	if err := sink.Write(testEvent("batch-2")); err == nil {
+		t.Error("Write() succeeded on a 500 response")
+	}
+}
+
+// recordingSink collects events, optionally blocking until released
+type recordingSink struct {
+	mu      sync.Mutex
+	events  []Event
+	started chan struct{}
+	release chan struct{}
+	closed  bool
+}
+
+func (s *recordingSink) Write(e Event) error {
+	if s.release != nil {
+		s.started <- struct{}{}
+		<-s.release
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, e)
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func TestAsync(t *testing.T) {
+	sink := &recordingSink{started: make(chan struct{}, 2), release: make(chan struct{})}
+	async := NewAsync(sink, 1, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// The first event is taken by the blocked writer, the second fills the
+	// queue and the third is dropped
+	if err := async.Write(testEvent("batch-1")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	<-sink.started
+	if err := async.Write(testEvent("batch-2")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := async.Write(testEvent("batch-3")); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("Write() to a full queue = %v, want ErrQueueFull", err)
+	}
+
+	close(sink.release)
+	if err := async.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if len(sink.events) != 2 || sink.events[1].Batch != "batch-2" || !sink.closed {
+		t.Errorf("sink got %+v, closed %v; want the queued events written and the sink closed", sink.events, sink.closed)
+	}
+	if err := async.Write(testEvent("late")); err == nil {
+		t.Error("Write() after Close() succeeded")
+	}
+}
+
+func TestMulti(t *testing.T) {
+	a, b := &recordingSink{}, &recordingSink{}
+	failing := NewHTTPSink("http://127.0.0.1:0", "")
+	multi := Multi{a, failing, b}
+
+	if err := multi.Write(testEvent("batch-1")); err == nil {
+		t.Error("Write() hid the failing sink")
+	}
+	if len(a.events) != 1 || len(b.events) != 1 {
+		t.Errorf("events written = %d and %d, want every working sink to get the event", len(a.events), len(b.events))
+	}
+	if err := multi.Close(); err != nil || !a.closed || !b.closed {
+		t.Errorf("Close() = %v, closed %v %v", err, a.closed, b.closed)
+	}
+}
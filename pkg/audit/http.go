@@ -0,0 +1,67 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// DefaultHTTPTimeout bounds a single delivery to an HTTP audit sink
+const DefaultHTTPTimeout = 10 * time.Second
+
+// HTTPSink posts every event as JSON to a URL, for shipping audit events to a
+// log collector
+type HTTPSink struct {
+	URL        string
+	Token      string
+	HTTPClient *http.Client
+}
+
+// NewHTTPSink creates a sink posting to url, authenticating with a bearer
+// token when one is given
+func NewHTTPSink(url, token string) *HTTPSink {
+	return &HTTPSink{
+		URL:   url,
+		Token: token,
+		HTTPClient: &http.Client{
+			Timeout: DefaultHTTPTimeout,
+		},
+	}
+}
+
+// Write posts the event, failing on any non-2xx response
+func (s *HTTPSink) Write(e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit event: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", s.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create audit request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send audit event: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("audit sink responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Close is a no-op for HTTP sinks
+func (s *HTTPSink) Close() error {
+	return nil
+}
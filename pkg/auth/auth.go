@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/metrics"
+)
+
+var rejections = metrics.NewCounterVec(
+	"simply_webhook_auth_rejections_total",
+	"Number of requests rejected by authentication, by reason.",
+	"reason",
+)
+
+// Authenticator checks that requests carry a valid bearer token or a
+// verified client certificate. Either is sufficient when both are enabled.
+type Authenticator struct {
+	// Token is the expected bearer token; empty disables token authentication
+	Token string
+	// ClientCerts accepts requests presenting a client certificate verified
+	// by the server's TLS configuration
+	ClientCerts bool
+	// Exempt lists paths served without authentication, such as probes
+	Exempt []string
+	Logger *slog.Logger
+}
+
+// LoadToken returns token, or the trimmed content of file when token is empty
+func LoadToken(token, file string) (string, error) {
+	if token != "" && file != "" {
+		return "", fmt.Errorf("API_TOKEN and API_TOKEN_FILE are mutually exclusive")
+	}
+	if file == "" {
+		return token, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token file: %w", err)
+	}
+	token = strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("token file %s is empty", file)
+	}
+	return token, nil
+}
+
+// Enabled reports whether any authentication method is configured
+func (a *Authenticator) Enabled() bool {
+	return a.Token != "" || a.ClientCerts
+}
+
+// Middleware rejects unauthenticated requests with 401
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.Enabled() || r.Method == http.MethodOptions || a.exempt(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		reason := a.check(r)
+		if reason == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rejections.Inc(reason)
+		a.Logger.Warn("Rejected unauthenticated request",
+			"reason", reason,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"remoteAddr", r.RemoteAddr,
+		)
+		if a.Token != "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="external-dns-simply-webhook"`)
+		}
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// check returns why a request is not authenticated, or "" if it is
+func (a *Authenticator) check(r *http.Request) string {
+	if a.ClientCerts && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return ""
+	}
+
+	header := r.Header.Get("Authorization")
+	if a.Token != "" && header != "" {
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(a.Token)) == 1 {
+			return ""
+		}
+		return "invalid_token"
+	}
+
+	if a.ClientCerts && a.Token == "" {
+		return "missing_client_certificate"
+	}
+	return "missing_credentials"
+}
+
+func (a *Authenticator) exempt(path string) bool {
+	for _, p := range a.Exempt {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
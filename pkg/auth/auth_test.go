@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	verified := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}
+
+	tests := []struct {
+		name          string
+		auth          Authenticator
+		method        string
+		path          string
+		header        string
+		tls           *tls.ConnectionState
+		want          int
+		wantChallenge bool
+	}{
+		{name: "disabled", auth: Authenticator{}, want: http.StatusOK},
+		{name: "valid token", auth: Authenticator{Token: "t0ken"}, header: "Bearer t0ken", want: http.StatusOK},
+		{name: "wrong token", auth: Authenticator{Token: "t0ken"}, header: "Bearer other", want: http.StatusUnauthorized, wantChallenge: true},
+		{name: "not a bearer token", auth: Authenticator{Token: "t0ken"}, header: "Basic t0ken", want: http.StatusUnauthorized, wantChallenge: true},
+		{name: "missing token", auth: Authenticator{Token: "t0ken"}, want: http.StatusUnauthorized, wantChallenge: true},
+		{name: "exempt probe", auth: Authenticator{Token: "t0ken", Exempt: []string{"/healthz"}}, path: "/healthz", want: http.StatusOK},
+		{name: "preflight", auth: Authenticator{Token: "t0ken"}, method: http.MethodOptions, want: http.StatusOK},
+		{name: "verified client certificate", auth: Authenticator{ClientCerts: true}, tls: verified, want: http.StatusOK},
+		{name: "TLS without client certificate", auth: Authenticator{ClientCerts: true}, tls: &tls.ConnectionState{}, want: http.StatusUnauthorized},
+		{name: "plain HTTP with client certificates required", auth: Authenticator{ClientCerts: true}, want: http.StatusUnauthorized},
+		{name: "token instead of certificate", auth: Authenticator{Token: "t0ken", ClientCerts: true}, tls: &tls.ConnectionState{}, header: "Bearer t0ken", want: http.StatusOK},
+		{name: "certificate instead of token", auth: Authenticator{Token: "t0ken", ClientCerts: true}, tls: verified, want: http.StatusOK},
+		{name: "neither token nor certificate", auth: Authenticator{Token: "t0ken", ClientCerts: true}, tls: &tls.ConnectionState{}, want: http.StatusUnauthorized, wantChallenge: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.auth.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+			handler := tt.auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			method, path := tt.method, tt.path
+			if method == "" {
+				method = http.MethodGet
+			}
+			if path == "" {
+				path = "/records"
+			}
+			req := httptest.NewRequest(method, path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			req.TLS = tt.tls
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if challenged := rec.Header().Get("WWW-Authenticate") != ""; challenged != tt.wantChallenge {
+				t.Errorf("WWW-Authenticate = %q", rec.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestLoadToken(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "token")
+	os.WriteFile(file, []byte("  t0ken\n"), 0o600)
+	empty := filepath.Join(dir, "empty")
+	os.WriteFile(empty, []byte("\n"), 0o600)
+
+	tests := []struct {
+		name    string
+		token   string
+		file    string
+		want    string
+		wantErr bool
+	}{
+		{name: "none", want: ""},
+		{name: "inline", token: "t0ken", want: "t0ken"},
+		{name: "file is trimmed", file: file, want: "t0ken"},
+		{name: "both", token: "t0ken", file: file, wantErr: true},
+		{name: "empty file", file: empty, wantErr: true},
+		{name: "missing file", file: filepath.Join(dir, "missing"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadToken(tt.token, tt.file)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("LoadToken() = %q, %v, want %q, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
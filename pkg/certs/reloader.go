@@ -0,0 +1,200 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/metrics"
+)
+
+// DefaultReloadInterval is how often the certificate files are checked for
+// changes
+const DefaultReloadInterval = time.Minute
+
+var (
+	certificateExpiry = metrics.NewGaugeVec(
+		"simply_webhook_tls_certificate_expiry_timestamp_seconds",
+		"Expiry of the served TLS certificate as a Unix timestamp.",
+	)
+	reloads = metrics.NewCounterVec(
+		"simply_webhook_tls_reloads_total",
+		"Number of TLS certificate reloads by result (success, error).",
+		"result",
+	)
+)
+
+// Reloader serves a certificate and client CA loaded from files, reloading
+// them when the files change so rotated certificates are picked up without a
+// restart
+type Reloader struct {
+	CertFile string
+	KeyFile  string
+	// CAFile, when set, holds the CAs client certificates are verified against
+	CAFile string
+	// RequireClientCert rejects TLS handshakes without a valid client
+	// certificate; otherwise client certificates are verified only if given
+	RequireClientCert bool
+	Interval          time.Duration
+	Logger            *slog.Logger
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+}
+
+// NewReloader loads the certificate, key and optional client CA
+func NewReloader(certFile, keyFile, caFile string, logger *slog.Logger) (*Reloader, error) {
+	r := &Reloader{
+		CertFile: certFile,
+		KeyFile:  keyFile,
+		CAFile:   caFile,
+		Interval: DefaultReloadInterval,
+		Logger:   logger,
+	}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// TLSConfig returns a server configuration that always uses the most recently
+// loaded certificate and client CAs. It offers HTTP/2 and HTTP/1.1 over ALPN,
+// as the per-client configuration replaces the one http.Server adds h2 to.
+func (r *Reloader) TLSConfig() *tls.Config {
+	base := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	server := base.Clone()
+	server.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		return r.cert, nil
+	}
+	server.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		config := base.Clone()
+		config.Certificates = []tls.Certificate{*r.cert}
+		if r.clientCAs != nil {
+			config.ClientCAs = r.clientCAs
+			config.ClientAuth = tls.VerifyClientCertIfGiven
+			if r.RequireClientCert {
+				config.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+		}
+		return config, nil
+	}
+	return server
+}
+
+// Reload loads the files if any of them changed since the last load,
+// reporting whether they did. On error the previous certificate stays in use.
+func (r *Reloader) Reload() (bool, error) {
+	modTimes, err := r.stat()
+	if err != nil {
+		reloads.Inc("error")
+		return false, err
+	}
+	if r.unchanged(modTimes) {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.CertFile, r.KeyFile)
+	if err != nil {
+		reloads.Inc("error")
+		return false, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		reloads.Inc("error")
+		return false, fmt.Errorf("failed to parse TLS certificate: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if r.CAFile != "" {
+		pem, err := os.ReadFile(r.CAFile)
+		if err != nil {
+			reloads.Inc("error")
+			return false, fmt.Errorf("failed to read client CA: %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			reloads.Inc("error")
+			return false, fmt.Errorf("client CA file %s contains no certificates", r.CAFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTimes = modTimes
+	r.mu.Unlock()
+
+	reloads.Inc("success")
+	certificateExpiry.Set(float64(leaf.NotAfter.Unix()))
+	r.Logger.Info("Loaded TLS certificate",
+		"subject", leaf.Subject.String(),
+		"notAfter", leaf.NotAfter,
+		"clientCA", r.CAFile != "",
+	)
+	return true, nil
+}
+
+// Run checks the files for changes every Interval until ctx is cancelled
+func (r *Reloader) Run(ctx context.Context) {
+	if r.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.Reload(); err != nil {
+				r.Logger.Error("Failed to reload TLS certificate, keeping the previous one", "error", err)
+			}
+		}
+	}
+}
+
+// stat returns the modification times of the files. Mounted secrets are
+// replaced through symlinks, which os.Stat follows.
+func (r *Reloader) stat() (map[string]time.Time, error) {
+	modTimes := make(map[string]time.Time)
+	for _, file := range []string{r.CertFile, r.KeyFile, r.CAFile} {
+		if file == "" {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %w", file, err)
+		}
+		modTimes[file] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+func (r *Reloader) unchanged(modTimes map[string]time.Time) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.modTimes == nil {
+		return false
+	}
+	for file, t := range modTimes {
+		if !r.modTimes[file].Equal(t) {
+			return false
+		}
+	}
+	return true
+}
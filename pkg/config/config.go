@@ -0,0 +1,611 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/certs"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/credentials"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/domains"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/notify"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/webhook"
+	"gopkg.in/yaml.v2"
+)
+
+// Redacted replaces secrets in the printed configuration
+const Redacted = "REDACTED"
+
+// Config is the configuration of the webhook server. It is read from an
+// optional YAML or JSON file, then overridden by environment variables.
+type Config struct {
+	// Accounts are the Simply.com accounts served; domains are routed to the
+	// account that owns them
+	Accounts []Account `yaml:"accounts"`
+	// ReloadInterval is how often the config file is checked for changes;
+	// zero disables reloading
+	ReloadInterval Duration `yaml:"reloadInterval"`
+	// CredentialsReloadInterval is how often credential files are re-read
+	CredentialsReloadInterval Duration `yaml:"credentialsReloadInterval"`
+
+	Domains   Domains   `yaml:"domains"`
+	TTL       TTL       `yaml:"ttl"`
+	Safety    Safety    `yaml:"safety"`
+	Protected Protected `yaml:"protected"`
+	// GetRecordsFailurePolicy is "fail" or "partial"
+	GetRecordsFailurePolicy string `yaml:"getRecordsFailurePolicy"`
+
+	Listen  Listen  `yaml:"listen"`
+	TLS     TLS     `yaml:"tls"`
+	Auth    Auth    `yaml:"auth"`
+	Logging Logging `yaml:"logging"`
+
+	HealthCacheTTL       Duration `yaml:"healthCacheTTL"`
+	ZoneLockTimeout      Duration `yaml:"zoneLockTimeout"`
+	ShutdownDrainTimeout Duration `yaml:"shutdownDrainTimeout"`
+
+	Journal Journal `yaml:"journal"`
+	Drift   Drift   `yaml:"drift"`
+	Audit   Audit   `yaml:"audit"`
+	Notify  Notify  `yaml:"notify"`
+}
+
+// Account holds the credentials of one Simply.com account. Each value is
+// given either directly or as a file, such as a mounted secret.
+type Account struct {
+	Name            string `yaml:"name"`
+	AccountName     string `yaml:"accountName,omitempty"`
+	AccountNameFile string `yaml:"accountNameFile,omitempty"`
+	APIKey          string `yaml:"apiKey,omitempty"`
+	APIKeyFile      string `yaml:"apiKeyFile,omitempty"`
+}
+
+// Domains selects the Simply.com domains the webhook manages
+type Domains struct {
+	Filter          []string `yaml:"filter"`
+	Exclude         []string `yaml:"exclude"`
+	RegexFilter     string   `yaml:"regexFilter"`
+	RegexExclusion  string   `yaml:"regexExclusion"`
+	RefreshInterval Duration `yaml:"refreshInterval"`
+}
+
+// TTL configures the TTL of created records
+type TTL struct {
+	// Default applies to endpoints without a TTL
+	Default int `yaml:"default"`
+	// Min and Max bound every TTL; a Max of zero means no upper bound
+	Min int `yaml:"min"`
+	Max int `yaml:"max"`
+	// Types holds default TTLs per record type
+	Types map[string]int `yaml:"types,omitempty"`
+	// Domains holds default TTLs per zone
+	Domains map[string]DomainTTL `yaml:"domains,omitempty"`
+}
+
+// DomainTTL holds the default TTLs of one zone
+type DomainTTL struct {
+	Default int            `yaml:"default,omitempty"`
+	Types   map[string]int `yaml:"types,omitempty"`
+}
+
+// Safety configures the guardrails of ApplyChanges batches
+type Safety struct {
+	MaxDeletes       int     `yaml:"maxDeletes"`
+	MaxDeletePercent float64 `yaml:"maxDeletePercent"`
+	MaxChanges       int     `yaml:"maxChanges"`
+	AllowMassChanges bool    `yaml:"allowMassChanges"`
+}
+
+// Protected lists records the webhook never modifies
+type Protected struct {
+	// Records are "name[:TYPE]" glob patterns
+	Records []string `yaml:"records"`
+	Hide    bool     `yaml:"hide"`
+}
+
+// Listen holds the listen addresses
+type Listen struct {
+	API     string `yaml:"api"`
+	Metrics string `yaml:"metrics"`
+}
+
+// TLS configures HTTPS serving
+type TLS struct {
+	CertFile          string   `yaml:"certFile"`
+	KeyFile           string   `yaml:"keyFile"`
+	ClientCAFile      string   `yaml:"clientCAFile"`
+	RequireClientCert bool     `yaml:"requireClientCert"`
+	ReloadInterval    Duration `yaml:"reloadInterval"`
+}
+
+// Auth configures API authentication and CORS
+type Auth struct {
+	Token              string   `yaml:"token,omitempty"`
+	TokenFile          string   `yaml:"tokenFile,omitempty"`
+	CORSAllowedOrigins []string `yaml:"corsAllowedOrigins"`
+}
+
+// Logging configures the logger
+type Logging struct {
+	// Level is debug, info, warn or error
+	Level string `yaml:"level"`
+}
+
+// Journal configures the write-ahead change journal
+type Journal struct {
+	Dir string `yaml:"dir"`
+}
+
+// Drift configures drift detection
+type Drift struct {
+	Interval  Duration `yaml:"interval"`
+	StateFile string   `yaml:"stateFile"`
+}
+
+// Audit configures the audit log
+type Audit struct {
+	File       string `yaml:"file"`
+	MaxSizeMB  int    `yaml:"maxSizeMB"`
+	MaxBackups int    `yaml:"maxBackups"`
+	HTTPURL    string `yaml:"httpURL"`
+	HTTPToken  string `yaml:"httpToken,omitempty"`
+}
+
+// Notify configures batch notifications
+type Notify struct {
+	URLs         []string `yaml:"urls"`
+	HMACSecret   string   `yaml:"hmacSecret,omitempty"`
+	TemplateFile string   `yaml:"templateFile"`
+	Retries      int      `yaml:"retries"`
+	Timeout      Duration `yaml:"timeout"`
+}
+
+// Duration is a time.Duration written as a string such as "30s" or "5m"
+type Duration time.Duration
+
+// UnmarshalYAML parses a duration string
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q, use a value such as 30s or 5m", s)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalYAML writes the duration as a string
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+// Defaults returns the configuration used when nothing is set
+func Defaults() *Config {
+	return &Config{
+		ReloadInterval:            Duration(DefaultReloadInterval),
+		CredentialsReloadInterval: Duration(credentials.DefaultReloadInterval),
+		Domains: Domains{
+			RefreshInterval: Duration(10 * time.Minute),
+		},
+		TTL:                     TTL{Default: webhook.DefaultTTL, Min: simply.MinTTL},
+		GetRecordsFailurePolicy: string(webhook.FailurePolicyFail),
+		Listen: Listen{
+			API:     ":8888",
+			Metrics: ":8080",
+		},
+		TLS: TLS{
+			ReloadInterval: Duration(certs.DefaultReloadInterval),
+		},
+		Logging:              Logging{Level: "info"},
+		HealthCacheTTL:       Duration(webhook.DefaultHealthCacheTTL),
+		ZoneLockTimeout:      Duration(webhook.DefaultZoneLockTimeout),
+		ShutdownDrainTimeout: Duration(30 * time.Second),
+		Audit: Audit{
+			MaxSizeMB:  100,
+			MaxBackups: 5,
+		},
+		Notify: Notify{
+			Retries: notify.DefaultRetries,
+			Timeout: Duration(notify.DefaultTimeout),
+		},
+	}
+}
+
+// Load builds the configuration from the defaults, the file at path (if
+// any) and the environment, in that order, and validates it. Unknown fields
+// in the file are rejected so typos do not go unnoticed.
+func Load(path string) (*Config, error) {
+	var data []byte
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+	}
+	return parse(path, data)
+}
+
+// LoadAudit reads only the audit settings from the file at path (if any) and
+// the environment. The other settings are neither required nor validated,
+// so CLI commands can share the audit log of the server configuration.
+func LoadAudit(path string) (Audit, error) {
+	section := struct {
+		Audit Audit `yaml:"audit"`
+	}{Defaults().Audit}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return Audit{}, fmt.Errorf("failed to read config file: %w", err)
+		}
+		if err := yaml.Unmarshal(bytes.TrimSpace(data), &section); err != nil {
+			return Audit{}, fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	}
+
+	if err := section.Audit.applyEnv(); err != nil {
+		return Audit{}, fmt.Errorf("invalid environment:\n  %s", err)
+	}
+	var problems []string
+	section.Audit.validate(func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	})
+	if len(problems) > 0 {
+		return Audit{}, fmt.Errorf("invalid audit configuration:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return section.Audit, nil
+}
+
+// parse builds the configuration from the contents of the file at path
+func parse(path string, data []byte) (*Config, error) {
+	config := Defaults()
+
+	// JSON is valid YAML, so both formats are parsed the same way
+	if err := yaml.UnmarshalStrict(bytes.TrimSpace(data), config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	if err := config.applyEnv(); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Validate checks the configuration, reporting every problem at once
+func (c *Config) Validate() error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if len(c.Accounts) == 0 {
+		add("accounts: at least one Simply.com account is required, set SIMPLY_ACCOUNT_NAME and SIMPLY_API_KEY")
+	}
+	seen := make(map[string]bool)
+	for i, account := range c.Accounts {
+		where := fmt.Sprintf("accounts[%d]", i)
+		if account.Name == "" {
+			add("%s.name is required", where)
+		} else if seen[account.Name] {
+			add("%s.name: duplicate account %q", where, account.Name)
+		}
+		seen[account.Name] = true
+		if account.AccountName != "" && account.AccountNameFile != "" {
+			add("%s: accountName and accountNameFile are mutually exclusive", where)
+		} else if account.AccountName == "" && account.AccountNameFile == "" {
+			add("%s: accountName or accountNameFile is required", where)
+		}
+		if account.APIKey != "" && account.APIKeyFile != "" {
+			add("%s: apiKey and apiKeyFile are mutually exclusive", where)
+		} else if account.APIKey == "" && account.APIKeyFile == "" {
+			add("%s: apiKey or apiKeyFile is required", where)
+		}
+	}
+
+	if _, err := c.Filter(); err != nil {
+		add("domains: %v", err)
+	}
+	if _, err := c.ProtectedRecords(); err != nil {
+		add("protected.records: %v", err)
+	}
+	if _, err := webhook.ParseFailurePolicy(c.GetRecordsFailurePolicy); err != nil {
+		add("getRecordsFailurePolicy: %v", err)
+	}
+	if _, err := ParseLevel(c.Logging.Level); err != nil {
+		add("logging.level: %v", err)
+	}
+
+	c.validateTTL(add)
+	if c.Safety.MaxDeletes < 0 {
+		add("safety.maxDeletes must not be negative")
+	}
+	if c.Safety.MaxChanges < 0 {
+		add("safety.maxChanges must not be negative")
+	}
+	if c.Safety.MaxDeletePercent < 0 || c.Safety.MaxDeletePercent > 100 {
+		add("safety.maxDeletePercent must be between 0 and 100")
+	}
+
+	for _, d := range []struct {
+		name  string
+		value Duration
+	}{
+		{"reloadInterval", c.ReloadInterval},
+		{"credentialsReloadInterval", c.CredentialsReloadInterval},
+		{"domains.refreshInterval", c.Domains.RefreshInterval},
+		{"tls.reloadInterval", c.TLS.ReloadInterval},
+		{"healthCacheTTL", c.HealthCacheTTL},
+		{"zoneLockTimeout", c.ZoneLockTimeout},
+		{"shutdownDrainTimeout", c.ShutdownDrainTimeout},
+		{"drift.interval", c.Drift.Interval},
+		{"notify.timeout", c.Notify.Timeout},
+	} {
+		if d.value < 0 {
+			add("%s must not be negative", d.name)
+		}
+	}
+
+	if c.Listen.API == "" {
+		add("listen.api is required")
+	}
+	if c.Listen.Metrics == "" {
+		add("listen.metrics is required")
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		add("tls: certFile and keyFile must be set together")
+	}
+	if c.TLS.ClientCAFile != "" && c.TLS.CertFile == "" {
+		add("tls.clientCAFile requires certFile and keyFile")
+	}
+	if c.TLS.RequireClientCert && c.TLS.ClientCAFile == "" {
+		add("tls.requireClientCert requires clientCAFile")
+	}
+	if c.Auth.Token != "" && c.Auth.TokenFile != "" {
+		add("auth: token and tokenFile are mutually exclusive")
+	}
+
+	c.Audit.validate(add)
+	if c.Notify.Retries < 0 {
+		add("notify.retries must not be negative")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// validate checks the audit settings
+func (a Audit) validate(add func(format string, args ...interface{})) {
+	if a.MaxSizeMB < 0 {
+		add("audit.maxSizeMB must not be negative")
+	}
+	if a.MaxBackups < 0 {
+		add("audit.maxBackups must not be negative")
+	}
+}
+
+// validateTTL checks that every default TTL lies within the allowed range
+func (c *Config) validateTTL(add func(format string, args ...interface{})) {
+	if c.TTL.Min < simply.MinTTL {
+		add("ttl.min must be at least %d, the lowest TTL Simply.com accepts", simply.MinTTL)
+	}
+	if c.TTL.Max < 0 {
+		add("ttl.max must not be negative")
+	} else if c.TTL.Max > 0 && c.TTL.Max < c.TTL.Min {
+		add("ttl.max must not be lower than ttl.min")
+	}
+
+	check := func(name string, ttl int) {
+		switch {
+		case ttl <= 0:
+			add("%s must be positive", name)
+		case ttl < c.TTL.Min:
+			add("%s must not be lower than ttl.min (%d)", name, c.TTL.Min)
+		case c.TTL.Max > 0 && ttl > c.TTL.Max:
+			add("%s must not be higher than ttl.max (%d)", name, c.TTL.Max)
+		}
+	}
+	checkTypes := func(where string, types map[string]int) {
+		for _, recordType := range sortedKeys(types) {
+			check(fmt.Sprintf("%s.types.%s", where, recordType), types[recordType])
+		}
+	}
+
+	check("ttl.default", c.TTL.Default)
+	checkTypes("ttl", c.TTL.Types)
+	zones := make([]string, 0, len(c.TTL.Domains))
+	for domain := range c.TTL.Domains {
+		zones = append(zones, domain)
+	}
+	sort.Strings(zones)
+	for _, domain := range zones {
+		d := c.TTL.Domains[domain]
+		where := fmt.Sprintf("ttl.domains.%s", domain)
+		if d.Default != 0 {
+			check(where+".default", d.Default)
+		}
+		checkTypes(where, d.Types)
+	}
+}
+
+// sortedKeys returns the keys of a TTL map in order, for stable messages
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// TTLPolicy returns the TTL defaults and bounds, with record types in upper
+// case and domains in lower case
+func (c *Config) TTLPolicy() webhook.TTLPolicy {
+	policy := webhook.TTLPolicy{
+		Default: c.TTL.Default,
+		Types:   upperKeys(c.TTL.Types),
+		Domains: make(map[string]webhook.DomainTTL, len(c.TTL.Domains)),
+		Min:     c.TTL.Min,
+		Max:     c.TTL.Max,
+	}
+	for domain, d := range c.TTL.Domains {
+		domain = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+		policy.Domains[domain] = webhook.DomainTTL{Default: d.Default, Types: upperKeys(d.Types)}
+	}
+	return policy
+}
+
+func upperKeys(m map[string]int) map[string]int {
+	upper := make(map[string]int, len(m))
+	for key, value := range m {
+		upper[strings.ToUpper(strings.TrimSpace(key))] = value
+	}
+	return upper
+}
+
+// Filter returns the domain filter
+func (c *Config) Filter() (domains.Filter, error) {
+	return domains.NewFilter(
+		strings.Join(c.Domains.Filter, ","),
+		strings.Join(c.Domains.Exclude, ","),
+		c.Domains.RegexFilter,
+		c.Domains.RegexExclusion,
+	)
+}
+
+// ProtectedRecords returns the parsed protected record patterns
+func (c *Config) ProtectedRecords() (webhook.ProtectedRecords, error) {
+	return webhook.ParseProtectedRecords(strings.Join(c.Protected.Records, ","))
+}
+
+// FailurePolicy returns the GetRecords failure policy
+func (c *Config) FailurePolicy() webhook.FailurePolicy {
+	policy, _ := webhook.ParseFailurePolicy(c.GetRecordsFailurePolicy)
+	return policy
+}
+
+// SafetyLimits returns the ApplyChanges safety limits
+func (c *Config) SafetyLimits() webhook.SafetyLimits {
+	return webhook.SafetyLimits{
+		MaxDeletes:       c.Safety.MaxDeletes,
+		MaxDeletePercent: c.Safety.MaxDeletePercent,
+		MaxChanges:       c.Safety.MaxChanges,
+		Override:         c.Safety.AllowMassChanges,
+	}
+}
+
+// Policy returns the handler settings that can be reloaded at runtime
+func (c *Config) Policy() *webhook.Policy {
+	filter, _ := c.Filter()
+	protected, _ := c.ProtectedRecords()
+	return &webhook.Policy{
+		Filter:           filter,
+		GetRecordsPolicy: c.FailurePolicy(),
+		Limits:           c.SafetyLimits(),
+		TTL:              c.TTLPolicy(),
+		Protected:        protected,
+		HideProtected:    c.Protected.Hide,
+	}
+}
+
+// LogLevel returns the configured log level
+func (c *Config) LogLevel() slog.Level {
+	level, _ := ParseLevel(c.Logging.Level)
+	return level
+}
+
+// ParseLevel parses a log level name
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info", "":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return slog.LevelInfo, fmt.Errorf("unknown log level %q, use debug, info, warn or error", s)
+	}
+}
+
+// CredentialSource returns where the credentials of an account are read from
+func (a Account) CredentialSource() credentials.Source {
+	return credentials.Source{
+		AccountName:     a.AccountName,
+		AccountNameFile: a.AccountNameFile,
+		APIKey:          a.APIKey,
+		APIKeyFile:      a.APIKeyFile,
+	}
+}
+
+// Redact returns a copy of the configuration with secrets replaced
+func (c *Config) Redact() *Config {
+	redacted := *c
+	redacted.Accounts = make([]Account, len(c.Accounts))
+	for i, account := range c.Accounts {
+		if account.APIKey != "" {
+			account.APIKey = Redacted
+		}
+		redacted.Accounts[i] = account
+	}
+	if redacted.Auth.Token != "" {
+		redacted.Auth.Token = Redacted
+	}
+	if redacted.Audit.HTTPToken != "" {
+		redacted.Audit.HTTPToken = Redacted
+	}
+	redacted.Audit.HTTPURL = RedactURL(c.Audit.HTTPURL)
+	if redacted.Notify.HMACSecret != "" {
+		redacted.Notify.HMACSecret = Redacted
+	}
+	if len(c.Notify.URLs) > 0 {
+		redacted.Notify.URLs = make([]string, len(c.Notify.URLs))
+		for i, u := range c.Notify.URLs {
+			redacted.Notify.URLs[i] = RedactURL(u)
+		}
+	}
+	return &redacted
+}
+
+// RedactURL keeps only the scheme and host of a URL, as webhook URLs often
+// carry a token in their user info, path or query
+func RedactURL(s string) string {
+	if s == "" {
+		return ""
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return Redacted
+	}
+	if u.User == nil && (u.Path == "" || u.Path == "/") && u.RawQuery == "" && u.Fragment == "" {
+		return s
+	}
+	return u.Scheme + "://" + u.Host + "/" + Redacted
+}
+
+// Write writes the configuration as YAML
+func (c *Config) Write(w io.Writer) error {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+	_, err = w.Write(data)
+	return err
+}
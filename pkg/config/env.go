@@ -0,0 +1,264 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/credentials"
+)
+
+// envInt reads an integer environment variable, returning def when unset
+func envInt(name string, def int) (int, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer, got %q", name, value)
+	}
+	return n, nil
+}
+
+// envFloat reads a floating point environment variable, returning def when unset
+func envFloat(name string, def float64) (float64, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative number, got %q", name, value)
+	}
+	return f, nil
+}
+
+// envBool reads a boolean environment variable, returning def when unset
+func envBool(name string, def bool) (bool, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s must be a boolean, got %q", name, value)
+	}
+	return b, nil
+}
+
+// envDuration reads a duration environment variable such as "30s", returning def when unset
+func envDuration(name string, def time.Duration) (time.Duration, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative duration such as 30s or 5m, got %q", name, value)
+	}
+	return d, nil
+}
+
+// envString overrides s with a string environment variable if it is set
+func envString(name string, s *string) {
+	if value, ok := os.LookupEnv(name); ok {
+		*s = strings.TrimSpace(value)
+	}
+}
+
+// envList reads a comma-separated environment variable, dropping empty items
+func envList(name string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// applyEnv overrides the configuration with the environment variables that
+// are set, reporting every invalid value at once
+func (c *Config) applyEnv() error {
+	var problems []string
+	check := func(err error) {
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	var err error
+	duration := func(name string, d *Duration) {
+		var value time.Duration
+		value, err = envDuration(name, time.Duration(*d))
+		check(err)
+		*d = Duration(value)
+	}
+	str := envString
+	list := func(name string, l *[]string) {
+		if _, ok := os.LookupEnv(name); ok {
+			*l = envList(name)
+		}
+	}
+
+	duration("CONFIG_RELOAD_INTERVAL", &c.ReloadInterval)
+	check(c.applyAccountsEnv())
+	duration("CREDENTIALS_RELOAD_INTERVAL", &c.CredentialsReloadInterval)
+
+	list("DOMAIN_FILTER", &c.Domains.Filter)
+	list("EXCLUDE_DOMAINS", &c.Domains.Exclude)
+	str("REGEX_DOMAIN_FILTER", &c.Domains.RegexFilter)
+	str("REGEX_DOMAIN_EXCLUSION", &c.Domains.RegexExclusion)
+	duration("DOMAIN_REFRESH_INTERVAL", &c.Domains.RefreshInterval)
+
+	c.TTL.Default, err = envInt("DEFAULT_TTL", c.TTL.Default)
+	check(err)
+	c.TTL.Min, err = envInt("MIN_TTL", c.TTL.Min)
+	check(err)
+	c.TTL.Max, err = envInt("MAX_TTL", c.TTL.Max)
+	check(err)
+
+	c.Safety.MaxDeletes, err = envInt("MAX_DELETES", c.Safety.MaxDeletes)
+	check(err)
+	c.Safety.MaxDeletePercent, err = envFloat("MAX_DELETE_PERCENT", c.Safety.MaxDeletePercent)
+	check(err)
+	c.Safety.MaxChanges, err = envInt("MAX_CHANGES", c.Safety.MaxChanges)
+	check(err)
+	c.Safety.AllowMassChanges, err = envBool("ALLOW_MASS_CHANGES", c.Safety.AllowMassChanges)
+	check(err)
+
+	list("PROTECTED_RECORDS", &c.Protected.Records)
+	c.Protected.Hide, err = envBool("HIDE_PROTECTED_RECORDS", c.Protected.Hide)
+	check(err)
+	str("GET_RECORDS_FAILURE_POLICY", &c.GetRecordsFailurePolicy)
+
+	// PORT is kept for compatibility and only applies without API_LISTEN_ADDR
+	if port := strings.TrimSpace(os.Getenv("PORT")); port != "" {
+		c.Listen.API = ":" + port
+	}
+	str("API_LISTEN_ADDR", &c.Listen.API)
+	str("METRICS_LISTEN_ADDR", &c.Listen.Metrics)
+
+	str("TLS_CERT_FILE", &c.TLS.CertFile)
+	str("TLS_KEY_FILE", &c.TLS.KeyFile)
+	str("TLS_CLIENT_CA_FILE", &c.TLS.ClientCAFile)
+	c.TLS.RequireClientCert, err = envBool("TLS_REQUIRE_CLIENT_CERT", c.TLS.RequireClientCert)
+	check(err)
+	duration("TLS_RELOAD_INTERVAL", &c.TLS.ReloadInterval)
+
+	check(secret("API_TOKEN", "API_TOKEN_FILE", &c.Auth.Token, &c.Auth.TokenFile))
+	list("CORS_ALLOWED_ORIGINS", &c.Auth.CORSAllowedOrigins)
+
+	str("LOG_LEVEL", &c.Logging.Level)
+
+	duration("HEALTH_CACHE_TTL", &c.HealthCacheTTL)
+	duration("ZONE_LOCK_TIMEOUT", &c.ZoneLockTimeout)
+	duration("SHUTDOWN_DRAIN_TIMEOUT", &c.ShutdownDrainTimeout)
+
+	str("JOURNAL_DIR", &c.Journal.Dir)
+	duration("DRIFT_CHECK_INTERVAL", &c.Drift.Interval)
+	str("DRIFT_STATE_FILE", &c.Drift.StateFile)
+
+	check(c.Audit.applyEnv())
+
+	list("NOTIFY_WEBHOOK_URLS", &c.Notify.URLs)
+	str("NOTIFY_HMAC_SECRET", &c.Notify.HMACSecret)
+	str("NOTIFY_TEMPLATE_FILE", &c.Notify.TemplateFile)
+	c.Notify.Retries, err = envInt("NOTIFY_RETRIES", c.Notify.Retries)
+	check(err)
+	duration("NOTIFY_TIMEOUT", &c.Notify.Timeout)
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid environment:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// applyEnv overrides the audit settings with the environment variables that
+// are set, reporting every invalid value at once
+func (a *Audit) applyEnv() error {
+	var problems []string
+	var err error
+
+	envString("AUDIT_LOG_FILE", &a.File)
+	if a.MaxSizeMB, err = envInt("AUDIT_LOG_MAX_SIZE", a.MaxSizeMB); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if a.MaxBackups, err = envInt("AUDIT_LOG_MAX_BACKUPS", a.MaxBackups); err != nil {
+		problems = append(problems, err.Error())
+	}
+	envString("AUDIT_HTTP_URL", &a.HTTPURL)
+	envString("AUDIT_HTTP_TOKEN", &a.HTTPToken)
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// applyAccountsEnv overrides the accounts. SIMPLY_ACCOUNTS lists the accounts
+// whose credentials are read from SIMPLY_<NAME>_ACCOUNT_NAME and
+// SIMPLY_<NAME>_API_KEY; otherwise SIMPLY_ACCOUNT_NAME and SIMPLY_API_KEY
+// apply to the first account, which is created if the file has none.
+func (c *Config) applyAccountsEnv() error {
+	names := envList("SIMPLY_ACCOUNTS")
+	if len(names) == 0 {
+		source := credentials.FromEnv()
+		if source == (credentials.Source{Prefix: credentials.DefaultPrefix}) {
+			return nil
+		}
+		if len(c.Accounts) == 0 {
+			c.Accounts = []Account{{Name: "default"}}
+		}
+		return c.Accounts[0].override(source)
+	}
+
+	var errs []string
+	accounts := make([]Account, 0, len(names))
+	for _, name := range names {
+		account := Account{Name: name}
+		for _, existing := range c.Accounts {
+			if existing.Name == name {
+				account = existing
+			}
+		}
+		if err := account.override(credentials.FromEnvPrefix(credentials.AccountPrefix(name))); err != nil {
+			errs = append(errs, err.Error())
+		}
+		accounts = append(accounts, account)
+	}
+	c.Accounts = accounts
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "\n  "))
+	}
+	return nil
+}
+
+// override replaces the credentials set in source; setting a value clears
+// the corresponding file and vice versa
+func (a *Account) override(source credentials.Source) error {
+	p := source.Prefix
+	if err := override(p+"ACCOUNT_NAME", p+"ACCOUNT_NAME_FILE", source.AccountName, source.AccountNameFile, &a.AccountName, &a.AccountNameFile); err != nil {
+		return err
+	}
+	return override(p+"API_KEY", p+"API_KEY_FILE", source.APIKey, source.APIKeyFile, &a.APIKey, &a.APIKeyFile)
+}
+
+// secret overrides a value that may also be given as a file
+func secret(name, fileName string, target, targetFile *string) error {
+	return override(name, fileName, strings.TrimSpace(os.Getenv(name)), strings.TrimSpace(os.Getenv(fileName)), target, targetFile)
+}
+
+func override(name, fileName, value, file string, target, targetFile *string) error {
+	switch {
+	case value != "" && file != "":
+		return fmt.Errorf("%s and %s are mutually exclusive", name, fileName)
+	case value != "":
+		*target, *targetFile = value, ""
+	case file != "":
+		*target, *targetFile = "", file
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/metrics"
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultReloadInterval is how often the config file is checked for changes
+const DefaultReloadInterval = 30 * time.Second
+
+var reloads = metrics.NewCounterVec(
+	"simply_webhook_config_reloads_total",
+	"Number of config file reloads by result (success, error).",
+	"result",
+)
+
+// reloadable lists the settings applied to the running server when the file
+// changes; every other setting only takes effect after a restart
+var reloadable = []string{
+	"domains.filter",
+	"domains.exclude",
+	"domains.regexFilter",
+	"domains.regexExclusion",
+	"ttl",
+	"safety",
+	"protected",
+	"getRecordsFailurePolicy",
+	"logging.level",
+}
+
+// withReloadable returns a copy of c with the reloadable settings, as listed
+// in reloadable, taken from next. Settings that need a restart keep the
+// values the server is running with.
+func (c *Config) withReloadable(next *Config) *Config {
+	merged := *c
+	merged.Domains.Filter = next.Domains.Filter
+	merged.Domains.Exclude = next.Domains.Exclude
+	merged.Domains.RegexFilter = next.Domains.RegexFilter
+	merged.Domains.RegexExclusion = next.Domains.RegexExclusion
+	merged.TTL = next.TTL
+	merged.Safety = next.Safety
+	merged.Protected = next.Protected
+	merged.GetRecordsFailurePolicy = next.GetRecordsFailurePolicy
+	merged.Logging.Level = next.Logging.Level
+	return &merged
+}
+
+// Change is a setting that differs between two configurations
+type Change struct {
+	// Path is the dotted path of the setting, e.g. "safety.maxDeletes"
+	Path string
+	// Old and New are the values, with secrets redacted
+	Old string
+	New string
+	// Reloadable reports whether the change is applied without a restart
+	Reloadable bool
+}
+
+// Diff returns the settings that differ between two configurations, sorted
+// by path. Secrets and webhook URLs are compared in full but reported
+// redacted.
+func Diff(old, new *Config) []Change {
+	oldValues, newValues := flatten(old), flatten(new)
+	oldShown, newShown := flatten(old.Redact()), flatten(new.Redact())
+
+	paths := make(map[string]bool)
+	for path := range oldValues {
+		paths[path] = true
+	}
+	for path := range newValues {
+		paths[path] = true
+	}
+
+	var changes []Change
+	for path := range paths {
+		if oldValues[path] == newValues[path] {
+			continue
+		}
+		changes = append(changes, Change{
+			Path:       path,
+			Old:        oldShown[path],
+			New:        newShown[path],
+			Reloadable: isReloadable(path),
+		})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+func isReloadable(path string) bool {
+	for _, prefix := range reloadable {
+		if path == prefix || strings.HasPrefix(path, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// flatten maps the dotted path of every setting to its value as written in YAML
+func flatten(c *Config) map[string]string {
+	values := make(map[string]string)
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return values
+	}
+	var tree interface{}
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return values
+	}
+	flattenValue("", tree, values)
+	return values
+}
+
+func flattenValue(path string, v interface{}, values map[string]string) {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		for key, item := range v {
+			name := fmt.Sprint(key)
+			if path != "" {
+				name = path + "." + name
+			}
+			flattenValue(name, item, values)
+		}
+	case []interface{}:
+		// Lists of values are compared as a whole, lists of objects per item
+		var items []string
+		for i, item := range v {
+			if _, ok := item.(map[interface{}]interface{}); ok {
+				flattenValue(fmt.Sprintf("%s[%d]", path, i), item, values)
+				continue
+			}
+			items = append(items, fmt.Sprint(item))
+		}
+		if len(items) > 0 || len(v) == 0 {
+			values[path] = "[" + strings.Join(items, ", ") + "]"
+		}
+	case nil:
+		values[path] = ""
+	default:
+		values[path] = fmt.Sprint(v)
+	}
+}
+
+// Watcher re-reads the config file when its contents change and hands every
+// valid new configuration to OnChange. An invalid file, or one OnChange
+// rejects, is logged and the running configuration is kept.
+type Watcher struct {
+	Path     string
+	Interval time.Duration
+	Logger   *slog.Logger
+
+	// OnChange is called when a setting that can be reloaded has changed,
+	// with the running configuration updated with the reloadable settings of
+	// the file. An error rejects the whole reload.
+	OnChange func(*Config) error
+
+	mu      sync.Mutex
+	current *Config
+	sum     [sha256.Size]byte
+}
+
+// NewWatcher watches the file at path, which current was loaded from
+func NewWatcher(path string, current *Config, logger *slog.Logger, onChange func(*Config) error) (*Watcher, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return &Watcher{
+		Path:     path,
+		Interval: time.Duration(current.ReloadInterval),
+		Logger:   logger,
+		OnChange: onChange,
+		current:  current,
+		sum:      sha256.Sum256(data),
+	}, nil
+}
+
+// Reload loads the file if its contents changed since the last load,
+// reporting whether a reloadable setting changed. On error the running
+// configuration stays in effect.
+func (w *Watcher) Reload() (bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	data, err := os.ReadFile(w.Path)
+	if err != nil {
+		reloads.Inc("error")
+		return false, fmt.Errorf("failed to read config file: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	if sum == w.sum {
+		return false, nil
+	}
+	// Remember the contents even when they are invalid, so the error is
+	// reported once rather than on every check
+	w.sum = sum
+
+	next, err := parse(w.Path, data)
+	if err != nil {
+		reloads.Inc("error")
+		return false, err
+	}
+
+	changes := Diff(w.current, next)
+
+	apply := false
+	for _, change := range changes {
+		if change.Reloadable {
+			w.Logger.Info("Configuration changed", "setting", change.Path, "old", change.Old, "new", change.New)
+			apply = true
+		} else {
+			w.Logger.Warn("Configuration changed, restart to apply", "setting", change.Path, "old", change.Old, "new", change.New)
+		}
+	}
+	if len(changes) == 0 {
+		w.Logger.Debug("Config file changed without changing any setting", "file", w.Path)
+	}
+
+	if !apply {
+		reloads.Inc("success")
+		return false, nil
+	}
+
+	// Settings that need a restart keep their running values, so they are
+	// reported again until the server is restarted
+	merged := w.current.withReloadable(next)
+	if w.OnChange != nil {
+		if err := w.OnChange(merged); err != nil {
+			reloads.Inc("error")
+			return false, fmt.Errorf("configuration rejected: %w", err)
+		}
+	}
+	w.current = merged
+	reloads.Inc("success")
+	return true, nil
+}
+
+// Run checks the file for changes every Interval until ctx is cancelled
+func (w *Watcher) Run(ctx context.Context) {
+	if w.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := w.Reload(); err != nil {
+				w.Logger.Error("Failed to reload configuration, keeping the running configuration", "file", w.Path, "error", err)
+			}
+		}
+	}
+}
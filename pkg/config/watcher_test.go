@@ -0,0 +1,113 @@
+package config
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestWatcher writes contents to a config file and watches it, recording
+// every configuration handed to OnChange
+func newTestWatcher(t *testing.T, contents string, onChange func(*Config) error) (*Watcher, string, *[]*Config) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	current, err := parse(path, []byte(contents))
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+
+	var applied []*Config
+	w, err := NewWatcher(path, current, slog.New(slog.NewTextHandler(io.Discard, nil)), func(c *Config) error {
+		applied = append(applied, c)
+		if onChange != nil {
+			return onChange(c)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("NewWatcher() error = %v", err)
+	}
+	return w, path, &applied
+}
+
+func TestWatcherKeepsSettingsThatNeedARestart(t *testing.T) {
+	w, path, applied := newTestWatcher(t, account+"listen:\n  api: \":8888\"\n", nil)
+
+	next := account + "listen:\n  api: \":9999\"\nttl:\n  default: 300\n"
+	if err := os.WriteFile(path, []byte(next), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := w.Reload()
+	if err != nil || !changed {
+		t.Fatalf("Reload() = %v, %v, want true, nil", changed, err)
+	}
+
+	if len(*applied) != 1 {
+		t.Fatalf("OnChange called %d times, want 1", len(*applied))
+	}
+	for _, c := range []*Config{(*applied)[0], w.current} {
+		if c.TTL.Default != 300 {
+			t.Errorf("TTL.Default = %d, want the reloaded 300", c.TTL.Default)
+		}
+		if c.Listen.API != ":8888" {
+			t.Errorf("Listen.API = %q, want the running :8888 until a restart", c.Listen.API)
+		}
+	}
+
+	// Only a restart-only change is left: nothing to apply
+	if err := os.WriteFile(path, []byte(next+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := w.Reload(); err != nil || changed {
+		t.Errorf("Reload() = %v, %v, want false, nil", changed, err)
+	}
+}
+
+func TestWatcherRejectedReloadKeepsRunningConfiguration(t *testing.T) {
+	rejected := errors.New("no domains match")
+	w, path, applied := newTestWatcher(t, account+"domains:\n  filter: [example.com]\n", func(c *Config) error {
+		return rejected
+	})
+
+	if err := os.WriteFile(path, []byte(account+"domains:\n  filter: [example.org]\nttl:\n  default: 300\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := w.Reload()
+	if !errors.Is(err, rejected) || changed {
+		t.Fatalf("Reload() = %v, %v, want false and the OnChange error", changed, err)
+	}
+	if len(*applied) != 1 {
+		t.Fatalf("OnChange called %d times, want 1", len(*applied))
+	}
+	if got := w.current.Domains.Filter; len(got) != 1 || got[0] != "example.com" {
+		t.Errorf("Domains.Filter = %v, want the running [example.com]", got)
+	}
+	if w.current.TTL.Default != 3600 {
+		t.Errorf("TTL.Default = %d, want the running 3600", w.current.TTL.Default)
+	}
+}
+
+func TestWatcherInvalidFileKeepsRunningConfiguration(t *testing.T) {
+	w, path, applied := newTestWatcher(t, account, nil)
+
+	if err := os.WriteFile(path, []byte(account+"ttl:\n  default: many\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Reload(); err == nil {
+		t.Fatal("Reload() of an invalid file succeeded")
+	}
+	if len(*applied) != 0 {
+		t.Errorf("OnChange called with an invalid file")
+	}
+
+	// The same invalid contents are reported once
+	if _, err := w.Reload(); err != nil {
+		t.Errorf("Reload() of unchanged contents error = %v", err)
+	}
+}
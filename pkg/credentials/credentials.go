@@ -0,0 +1,234 @@
+package credentials
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/metrics"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
+)
+
+// DefaultReloadInterval is how often credential files are re-read
+const DefaultReloadInterval = time.Minute
+
+var (
+	credentialChanges = metrics.NewCounterVec(
+		"simply_webhook_credential_changes_total",
+		"Number of times the Simply.com credentials were reloaded with new values, by account.",
+		"account",
+	)
+	credentialErrors = metrics.NewCounterVec(
+		"simply_webhook_credential_reload_errors_total",
+		"Number of failed reads of the Simply.com credential files, by account.",
+		"account",
+	)
+	credentialsValid = metrics.NewGaugeVec(
+		"simply_webhook_credentials_valid",
+		"Whether Simply.com accepted the credentials of an account on the most recent request (1) or rejected them (0).",
+		"account",
+	)
+)
+
+// DefaultPrefix is the environment variable prefix of the default account
+const DefaultPrefix = "SIMPLY_"
+
+// Source describes where the Simply.com credentials come from. Each value is
+// read either from the variable itself or from a file, such as a mounted
+// Kubernetes secret.
+type Source struct {
+	// Prefix of the environment variables the values were read from, used in
+	// error messages; empty when they come from the configuration file
+	Prefix          string
+	AccountName     string
+	AccountNameFile string
+	APIKey          string
+	APIKeyFile      string
+}
+
+// FromEnv reads the credential source from SIMPLY_ACCOUNT_NAME,
+// SIMPLY_API_KEY and their _FILE variants
+func FromEnv() Source {
+	return FromEnvPrefix(DefaultPrefix)
+}
+
+// FromEnvPrefix reads the credential source from <prefix>ACCOUNT_NAME,
+// <prefix>API_KEY and their _FILE variants
+func FromEnvPrefix(prefix string) Source {
+	return Source{
+		Prefix:          prefix,
+		AccountName:     os.Getenv(prefix + "ACCOUNT_NAME"),
+		AccountNameFile: os.Getenv(prefix + "ACCOUNT_NAME_FILE"),
+		APIKey:          os.Getenv(prefix + "API_KEY"),
+		APIKeyFile:      os.Getenv(prefix + "API_KEY_FILE"),
+	}
+}
+
+// AccountPrefix returns the environment variable prefix of a named account,
+// e.g. SIMPLY_LEGACY_ for "legacy"
+func AccountPrefix(account string) string {
+	name := strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(account))
+	return DefaultPrefix + name + "_"
+}
+
+// FromFiles reports whether any credential is read from a file, and may
+// therefore change at runtime
+func (s Source) FromFiles() bool {
+	return s.AccountNameFile != "" || s.APIKeyFile != ""
+}
+
+// Load returns the current account name and API key
+func (s Source) Load() (accountName, apiKey string, err error) {
+	names := [4]string{"accountName", "accountNameFile", "apiKey", "apiKeyFile"}
+	if s.Prefix != "" {
+		names = [4]string{s.Prefix + "ACCOUNT_NAME", s.Prefix + "ACCOUNT_NAME_FILE", s.Prefix + "API_KEY", s.Prefix + "API_KEY_FILE"}
+	}
+	if accountName, err = load(names[0], names[1], s.AccountName, s.AccountNameFile); err != nil {
+		return "", "", err
+	}
+	if apiKey, err = load(names[2], names[3], s.APIKey, s.APIKeyFile); err != nil {
+		return "", "", err
+	}
+	return accountName, apiKey, nil
+}
+
+// load returns value, or the trimmed content of file
+func load(name, fileName, value, file string) (string, error) {
+	if value != "" && file != "" {
+		return "", fmt.Errorf("%s and %s are mutually exclusive", name, fileName)
+	}
+	if file == "" {
+		if value == "" {
+			return "", fmt.Errorf("%s or %s is required", name, fileName)
+		}
+		return value, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", fileName, err)
+	}
+	value = strings.TrimSpace(string(data))
+	if value == "" {
+		return "", fmt.Errorf("%s %s is empty", fileName, file)
+	}
+	return value, nil
+}
+
+// Reloader re-reads credential files and swaps changed credentials into the
+// client, and reports when Simply.com starts or stops rejecting them
+type Reloader struct {
+	// Account names the account in logs and metrics
+	Account  string
+	Source   Source
+	Client   *simply.Client
+	Interval time.Duration
+	Logger   *slog.Logger
+
+	accountName string
+	keyHash     string
+	authFailed  bool
+}
+
+// NewReloader creates a reloader for a client created with the credentials
+// currently in source
+func NewReloader(account string, source Source, client *simply.Client, interval time.Duration, logger *slog.Logger) *Reloader {
+	r := &Reloader{
+		Account:  account,
+		Source:   source,
+		Client:   client,
+		Interval: interval,
+		Logger:   logger,
+	}
+	if accountName, apiKey, err := source.Load(); err == nil {
+		r.accountName = accountName
+		r.keyHash = fingerprint(apiKey)
+	}
+	credentialsValid.Set(1, account)
+	return r
+}
+
+// Reload reads the credentials and applies them if they changed. On error
+// the client keeps its current credentials.
+func (r *Reloader) Reload() error {
+	accountName, apiKey, err := r.Source.Load()
+	if err != nil {
+		credentialErrors.Inc(r.Account)
+		return err
+	}
+
+	keyHash := fingerprint(apiKey)
+	if accountName == r.accountName && keyHash == r.keyHash {
+		return nil
+	}
+
+	r.Client.SetCredentials(accountName, apiKey)
+	credentialChanges.Inc(r.Account)
+	r.Logger.Info("Simply.com credentials changed",
+		"account", r.Account,
+		"accountName", accountName,
+		"accountChanged", accountName != r.accountName,
+		"keyChanged", keyHash != r.keyHash,
+		"keyFingerprint", keyHash,
+	)
+	r.accountName = accountName
+	r.keyHash = keyHash
+
+	// Verify the new credentials right away rather than on the next change
+	if _, err := r.Client.ListDomains(); err != nil {
+		r.Logger.Warn("Failed to verify new Simply.com credentials", "account", r.Account, "error", err)
+	}
+	r.checkStatus()
+	return nil
+}
+
+// checkStatus logs when Simply.com starts or stops rejecting the credentials
+func (r *Reloader) checkStatus() {
+	failed := r.Client.Status().AuthFailed
+	if failed == r.authFailed {
+		return
+	}
+	r.authFailed = failed
+	if failed {
+		credentialsValid.Set(0, r.Account)
+		r.Logger.Error("Simply.com rejected the credentials", "account", r.Account, "accountName", r.accountName, "keyFingerprint", r.keyHash)
+		return
+	}
+	credentialsValid.Set(1, r.Account)
+	r.Logger.Info("Simply.com accepts the credentials again", "account", r.Account, "accountName", r.accountName)
+}
+
+// Run reloads the credential files every Interval until ctx is cancelled.
+// Credentials given directly in the environment are never reloaded, but
+// rejections are still reported.
+func (r *Reloader) Run(ctx context.Context) {
+	if r.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if r.Source.FromFiles() {
+				if err := r.Reload(); err != nil {
+					r.Logger.Error("Failed to reload Simply.com credentials, keeping the current ones", "account", r.Account, "error", err)
+				}
+			}
+			r.checkStatus()
+		}
+	}
+}
+
+// fingerprint identifies an API key in logs without revealing it
+func fingerprint(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:4])
+}
@@ -0,0 +1,166 @@
+package credentials
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
+)
+
+func writeFile(t *testing.T, path, contents string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSourceLoad(t *testing.T) {
+	dir := t.TempDir()
+	nameFile := filepath.Join(dir, "account-name")
+	keyFile := filepath.Join(dir, "api-key")
+	emptyFile := filepath.Join(dir, "empty")
+	writeFile(t, nameFile, "S123456\n")
+	writeFile(t, keyFile, "  key-from-file \n")
+	writeFile(t, emptyFile, "\n")
+
+	tests := []struct {
+		name     string
+		source   Source
+		wantName string
+		wantKey  string
+		wantErr  string
+	}{
+		{name: "values", source: Source{AccountName: "S1", APIKey: "key"}, wantName: "S1", wantKey: "key"},
+		{name: "files are trimmed", source: Source{AccountNameFile: nameFile, APIKeyFile: keyFile}, wantName: "S123456", wantKey: "key-from-file"},
+		{name: "value and file", source: Source{AccountName: "S1", APIKeyFile: keyFile}, wantName: "S1", wantKey: "key-from-file"},
+		{name: "both for one credential", source: Source{Prefix: "SIMPLY_", AccountName: "S1", APIKey: "key", APIKeyFile: keyFile}, wantErr: "SIMPLY_API_KEY and SIMPLY_API_KEY_FILE are mutually exclusive"},
+		{name: "missing key", source: Source{AccountName: "S1"}, wantErr: "apiKey or apiKeyFile is required"},
+		{name: "empty file", source: Source{Prefix: "SIMPLY_", AccountNameFile: emptyFile, APIKey: "key"}, wantErr: "SIMPLY_ACCOUNT_NAME_FILE " + emptyFile + " is empty"},
+		{name: "unreadable file", source: Source{AccountName: "S1", APIKeyFile: filepath.Join(dir, "missing")}, wantErr: "failed to read apiKeyFile"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, key, err := tt.source.Load()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Load() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || name != tt.wantName || key != tt.wantKey {
+				t.Errorf("Load() = %q, %q, %v, want %q, %q", name, key, err, tt.wantName, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestFromEnvPrefix(t *testing.T) {
+	t.Setenv("SIMPLY_LEGACY_ACCOUNT_NAME", "S2")
+	t.Setenv("SIMPLY_LEGACY_API_KEY_FILE", "/run/secrets/legacy-key")
+
+	prefix := AccountPrefix("legacy")
+	if prefix != "SIMPLY_LEGACY_" {
+		t.Fatalf("AccountPrefix() = %q", prefix)
+	}
+	if got := AccountPrefix("old-shop.dk"); got != "SIMPLY_OLD_SHOP_DK_" {
+		t.Errorf("AccountPrefix() = %q", got)
+	}
+
+	want := Source{Prefix: prefix, AccountName: "S2", APIKeyFile: "/run/secrets/legacy-key"}
+	if got := FromEnvPrefix(prefix); got != want {
+		t.Errorf("FromEnvPrefix() = %+v, want %+v", got, want)
+	}
+	if !want.FromFiles() || (Source{AccountName: "S2", APIKey: "key"}).FromFiles() {
+		t.Error("FromFiles() does not report file sources")
+	}
+}
+
+// fakeSimply accepts a single set of credentials, which can be rotated
+type fakeSimply struct {
+	mu       sync.Mutex
+	name     string
+	key      string
+	requests int
+}
+
+func (f *fakeSimply) rotate(name, key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.name, f.key = name, key
+}
+
+func (f *fakeSimply) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests++
+	name, key, _ := r.BasicAuth()
+	if name != f.name || key != f.key {
+		http.Error(w, `{"message":"invalid credentials"}`, http.StatusUnauthorized)
+		return
+	}
+	fmt.Fprint(w, `{"products":[]}`)
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "api-key")
+	writeFile(t, keyFile, "old-key")
+
+	fake := &fakeSimply{name: "S123456", key: "old-key"}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	source := Source{AccountName: "S123456", APIKeyFile: keyFile}
+	name, key, err := source.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := simply.NewClient(name, key)
+	client.BaseURL = server.URL + "/"
+	r := NewReloader("default", source, client, DefaultReloadInterval, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// Unchanged files do not touch the client
+	if err := r.Reload(); err != nil || fake.requests != 0 {
+		t.Fatalf("Reload() = %v after %d requests, want nothing to do", err, fake.requests)
+	}
+
+	// Simply.com rotates the key before the secret is updated
+	fake.rotate("S123456", "new-key")
+	if _, err := client.ListDomains(); err == nil {
+		t.Fatal("ListDomains() succeeded with a revoked key")
+	}
+	r.checkStatus()
+	if !r.authFailed {
+		t.Error("rejected credentials not reported")
+	}
+
+	// The new key is picked up and verified
+	writeFile(t, keyFile, "new-key\n")
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if client.Status().AuthFailed || r.authFailed {
+		t.Error("credentials still reported as rejected after the reload")
+	}
+	if _, err := client.ListDomains(); err != nil {
+		t.Errorf("ListDomains() error = %v after the reload", err)
+	}
+
+	// A broken file keeps the working credentials
+	writeFile(t, keyFile, "")
+	if err := r.Reload(); err == nil {
+		t.Error("Reload() of an empty key file succeeded")
+	}
+	if _, err := client.ListDomains(); err != nil {
+		t.Errorf("ListDomains() error = %v, want the previous key kept", err)
+	}
+}
@@ -0,0 +1,190 @@
+package domains
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// Filter selects which Simply.com domains the webhook manages. It mirrors
+// ExternalDNS's --domain-filter, --exclude-domains, --regex-domain-filter and
+// --regex-domain-exclusion flags.
+type Filter struct {
+	// Include lists domains to manage. A plain entry matches the domain and
+	// its subdomains, an entry with a leading dot only subdomains, and entries
+	// containing "*" are glob patterns. An empty list matches everything.
+	Include []string
+	// Exclude lists domains never to manage, using the same syntax as Include
+	Exclude []string
+	// RegexInclude, when set, must match a domain for it to be managed
+	RegexInclude *regexp.Regexp
+	// RegexExclude, when set, excludes every domain it matches
+	RegexExclude *regexp.Regexp
+}
+
+// NewFilter builds a filter from comma-separated include and exclude lists and
+// optional regular expressions. Like ExternalDNS, lists and regular
+// expressions cannot be combined.
+func NewFilter(include, exclude, regexInclude, regexExclude string) (Filter, error) {
+	f := Filter{
+		Include: splitList(include),
+		Exclude: splitList(exclude),
+	}
+
+	for _, pattern := range append(append([]string{}, f.Include...), f.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return Filter{}, fmt.Errorf("invalid domain pattern %q: %w", pattern, err)
+		}
+	}
+
+	var err error
+	if regexInclude != "" {
+		if f.RegexInclude, err = regexp.Compile(regexInclude); err != nil {
+			return Filter{}, fmt.Errorf("invalid regex domain filter: %w", err)
+		}
+	}
+	if regexExclude != "" {
+		if f.RegexExclude, err = regexp.Compile(regexExclude); err != nil {
+			return Filter{}, fmt.Errorf("invalid regex domain exclusion: %w", err)
+		}
+	}
+
+	if f.hasRegex() && (len(f.Include) > 0 || len(f.Exclude) > 0) {
+		return Filter{}, fmt.Errorf("domain lists and regex domain filters cannot be combined")
+	}
+
+	return f, nil
+}
+
+// splitList splits and normalizes a comma-separated domain list
+func splitList(s string) []string {
+	var list []string
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(entry), "."))
+		if entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
+
+func (f Filter) hasRegex() bool {
+	return f.RegexInclude != nil || f.RegexExclude != nil
+}
+
+// IsConfigured reports whether any filter has been set
+func (f Filter) IsConfigured() bool {
+	return len(f.Include) > 0 || len(f.Exclude) > 0 || f.hasRegex()
+}
+
+// Match reports whether a domain passes the filter
+func (f Filter) Match(domain string) bool {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+
+	if f.hasRegex() {
+		if f.RegexInclude != nil && !f.RegexInclude.MatchString(domain) {
+			return false
+		}
+		return f.RegexExclude == nil || !f.RegexExclude.MatchString(domain)
+	}
+
+	if len(f.Include) > 0 && !matchAny(f.Include, domain) {
+		return false
+	}
+	return !matchAny(f.Exclude, domain)
+}
+
+// matchAny reports whether any pattern in the list matches domain
+func matchAny(patterns []string, domain string) bool {
+	for _, pattern := range patterns {
+		switch {
+		case strings.Contains(pattern, "*"):
+			if ok, _ := path.Match(pattern, domain); ok {
+				return true
+			}
+		case strings.HasPrefix(pattern, "."):
+			if strings.HasSuffix(domain, pattern) {
+				return true
+			}
+		case domain == pattern || strings.HasSuffix(domain, "."+pattern):
+			return true
+		}
+	}
+	return false
+}
+
+// Apply returns the sorted subset of domains that pass the filter
+func (f Filter) Apply(domains []string) []string {
+	var matched []string
+	for _, domain := range domains {
+		if f.Match(domain) {
+			matched = append(matched, domain)
+		}
+	}
+	sort.Strings(matched)
+	return matched
+}
+
+// Unmatched returns the Include entries that match none of the given domains,
+// which usually means a typo or a domain not hosted at Simply.com
+func (f Filter) Unmatched(domains []string) []string {
+	var unmatched []string
+	for _, pattern := range f.Include {
+		found := false
+		for _, domain := range domains {
+			if matchAny([]string{pattern}, strings.ToLower(domain)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			unmatched = append(unmatched, pattern)
+		}
+	}
+	return unmatched
+}
+
+// ExternalDNSExclusions returns the Exclude entries expressed in ExternalDNS
+// domain filter syntax. "*.example.com" becomes ".example.com"; other glob
+// patterns have no equivalent and only apply to zone selection.
+func (f Filter) ExternalDNSExclusions() []string {
+	var exclusions []string
+	for _, pattern := range f.Exclude {
+		if rest, ok := strings.CutPrefix(pattern, "*"); ok && strings.HasPrefix(rest, ".") && !strings.Contains(rest, "*") {
+			exclusions = append(exclusions, rest)
+			continue
+		}
+		if !strings.Contains(pattern, "*") {
+			exclusions = append(exclusions, pattern)
+		}
+	}
+	return exclusions
+}
+
+// EndpointFilter returns the filter as reported to ExternalDNS in the
+// Negotiate response. ExternalDNS only negotiates once at startup, so the
+// filter rules are reported rather than the zones they currently resolve to,
+// letting ExternalDNS accept zones discovered later. Without a filter, or with
+// glob includes that have no ExternalDNS equivalent, the given zones are
+// reported instead.
+func (f Filter) EndpointFilter(zones []string) endpoint.DomainFilter {
+	if !f.IsConfigured() {
+		return endpoint.NewDomainFilter(zones)
+	}
+	if f.hasRegex() {
+		return endpoint.NewRegexDomainFilter(f.RegexInclude, f.RegexExclude)
+	}
+
+	include := f.Include
+	for _, pattern := range f.Include {
+		if strings.Contains(pattern, "*") {
+			include = zones
+			break
+		}
+	}
+	return endpoint.NewDomainFilterWithExclusions(include, f.ExternalDNSExclusions())
+}
@@ -0,0 +1,90 @@
+package domains
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewFilter(t *testing.T) {
+	tests := []struct {
+		name                                         string
+		include, exclude, regexInclude, regexExclude string
+		wantErr                                      bool
+	}{
+		{name: "empty"},
+		{name: "lists", include: "example.com, *.example.org", exclude: ".internal.example.com"},
+		{name: "regex", regexInclude: `\.com$`, regexExclude: `^test\.`},
+		{name: "invalid glob", include: "[example.com", wantErr: true},
+		{name: "invalid regex", regexInclude: "(", wantErr: true},
+		{name: "lists and regex combined", include: "example.com", regexExclude: "^test", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewFilter(tt.include, tt.exclude, tt.regexInclude, tt.regexExclude)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewFilter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	tests := []struct {
+		name                                         string
+		include, exclude, regexInclude, regexExclude string
+		domain                                       string
+		want                                         bool
+	}{
+		{name: "no filter matches everything", domain: "example.com", want: true},
+		{name: "plain entry matches domain", include: "example.com", domain: "example.com", want: true},
+		{name: "plain entry matches subdomain", include: "example.com", domain: "sub.example.com", want: true},
+		{name: "plain entry does not match suffix", include: "example.com", domain: "badexample.com", want: false},
+		{name: "leading dot skips domain", include: ".example.com", domain: "example.com", want: false},
+		{name: "leading dot matches subdomain", include: ".example.com", domain: "sub.example.com", want: true},
+		{name: "glob", include: "*.example.com", domain: "sub.example.com", want: true},
+		{name: "glob does not match apex", include: "*.example.com", domain: "example.com", want: false},
+		{name: "case and trailing dot", include: "Example.COM.", domain: "EXAMPLE.com.", want: true},
+		{name: "exclude wins", include: "example.com", exclude: "dev.example.com", domain: "api.dev.example.com", want: false},
+		{name: "exclude only", exclude: "example.org", domain: "example.com", want: true},
+		{name: "regex include", regexInclude: `\.com$`, domain: "example.com", want: true},
+		{name: "regex include mismatch", regexInclude: `\.com$`, domain: "example.org", want: false},
+		{name: "regex exclude", regexInclude: `\.com$`, regexExclude: `^test\.`, domain: "test.com", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewFilter(tt.include, tt.exclude, tt.regexInclude, tt.regexExclude)
+			if err != nil {
+				t.Fatalf("NewFilter() error = %v", err)
+			}
+			if got := f.Match(tt.domain); got != tt.want {
+				t.Errorf("Match(%q) = %v, want %v", tt.domain, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterApply(t *testing.T) {
+	f, err := NewFilter("example.com,*.example.org,missing.net", "dev.example.com", "", "")
+	if err != nil {
+		t.Fatalf("NewFilter() error = %v", err)
+	}
+	all := []string{"example.org", "shop.example.org", "example.com", "dev.example.com", "other.net"}
+
+	if got, want := f.Apply(all), []string{"example.com", "shop.example.org"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Apply() = %v, want %v", got, want)
+	}
+	if got, want := f.Unmatched(all), []string{"missing.net"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Unmatched() = %v, want %v", got, want)
+	}
+}
+
+func TestFilterExternalDNSExclusions(t *testing.T) {
+	f := Filter{Exclude: []string{"dev.example.com", "*.test.example.com", "shop-*.example.com"}}
+
+	want := []string{"dev.example.com", ".test.example.com"}
+	if got := f.ExternalDNSExclusions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ExternalDNSExclusions() = %v, want %v", got, want)
+	}
+}
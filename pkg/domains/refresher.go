@@ -0,0 +1,234 @@
+package domains
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/metrics"
+)
+
+var (
+	managedDomains = metrics.NewGaugeVec(
+		"simply_webhook_managed_domains",
+		"Number of Simply.com domains currently managed by the webhook.",
+	)
+	refreshErrors = metrics.NewCounterVec(
+		"simply_webhook_domain_refresh_errors_total",
+		"Number of failed Simply.com domain discoveries.",
+	)
+)
+
+// Lister lists the domains in a Simply.com account
+type Lister interface {
+	ListDomains() ([]string, error)
+}
+
+const (
+	// InitialBackoff is the delay before retrying a failed initial discovery
+	InitialBackoff = time.Second
+	// MaxBackoff caps the delay between initial discovery attempts
+	MaxBackoff = 2 * time.Minute
+)
+
+// Refresher discovers the Simply.com domains matching a filter, then
+// periodically re-discovers them and reports changes to the managed domain list
+type Refresher struct {
+	Lister   Lister
+	Interval time.Duration
+	Logger   *slog.Logger
+
+	// OnChange is called with the new domain list whenever it changes
+	OnChange func(domains []string)
+
+	mu      sync.Mutex
+	filter  Filter
+	listed  []string
+	current []string
+	trigger chan struct{}
+
+	// applyMu serializes updates of the managed domain list
+	applyMu sync.Mutex
+}
+
+// NewRefresher creates a refresher; no domains are managed until the first
+// successful discovery
+func NewRefresher(lister Lister, filter Filter, interval time.Duration, logger *slog.Logger, onChange func([]string)) *Refresher {
+	return &Refresher{
+		Lister:   lister,
+		Interval: interval,
+		Logger:   logger,
+		OnChange: onChange,
+		filter:   filter,
+		trigger:  make(chan struct{}, 1),
+	}
+}
+
+// Filter returns the filter domains are currently selected with
+func (r *Refresher) Filter() Filter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.filter
+}
+
+// SetFilter replaces the domain filter and applies it to the last listed
+// domains right away, so the managed domain list never lags behind the
+// filter. It then asks Run to list the domains again instead of waiting for
+// the next interval. A filter matching none of the listed domains is
+// rejected and the previous filter stays in effect.
+func (r *Refresher) SetFilter(filter Filter) error {
+	r.mu.Lock()
+	listed := r.listed
+	if listed != nil && len(filter.Apply(listed)) == 0 {
+		r.mu.Unlock()
+		return fmt.Errorf("no Simply.com domains match the new domain filter")
+	}
+	r.filter = filter
+	r.mu.Unlock()
+
+	if listed != nil {
+		if err := r.apply(listed); err != nil {
+			return err
+		}
+	}
+
+	select {
+	case r.trigger <- struct{}{}:
+	default:
+		// A refresh is already pending and will use the new filter
+	}
+	return nil
+}
+
+// Refresh lists the domains once and applies the result. On failure the
+// previous domain list stays in effect.
+func (r *Refresher) Refresh() error {
+	all, err := r.Lister.ListDomains()
+	if err != nil {
+		refreshErrors.Inc()
+		return fmt.Errorf("failed to list domains: %w", err)
+	}
+
+	r.mu.Lock()
+	r.listed = all
+	r.mu.Unlock()
+	return r.apply(all)
+}
+
+// apply filters the listed domains and makes the result the managed domain
+// list, reporting it through OnChange if it changed
+func (r *Refresher) apply(all []string) error {
+	r.applyMu.Lock()
+	defer r.applyMu.Unlock()
+
+	filter := r.Filter()
+	found := filter.Apply(all)
+	for _, pattern := range filter.Unmatched(all) {
+		r.Logger.Warn("Domain filter: entry matches no domain managed by Simply.com", "domain", pattern)
+	}
+	if len(found) == 0 {
+		refreshErrors.Inc()
+		return fmt.Errorf("no Simply.com domains match the domain filter")
+	}
+
+	added, removed := diff(r.domains(), found)
+	if len(added) == 0 && len(removed) == 0 {
+		r.Logger.Debug("Domain refresh found no changes", "count", len(found))
+		return nil
+	}
+
+	r.Logger.Info("Managed domains changed", "added", added, "removed", removed, "count", len(found))
+	r.mu.Lock()
+	r.current = found
+	r.mu.Unlock()
+	managedDomains.Set(float64(len(found)))
+	if r.OnChange != nil {
+		r.OnChange(found)
+	}
+	return nil
+}
+
+// Discover retries Refresh with exponential backoff until it succeeds or ctx
+// is cancelled
+func (r *Refresher) Discover(ctx context.Context) error {
+	backoff := InitialBackoff
+	for attempt := 1; ; attempt++ {
+		r.Logger.Info("Fetching domains from Simply.com.", "attempt", attempt)
+		err := r.Refresh()
+		if err == nil {
+			return nil
+		}
+
+		r.Logger.Error("Domain discovery failed, retrying", "attempt", attempt, "retryIn", backoff.String(), "error", err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > MaxBackoff {
+			backoff = MaxBackoff
+		}
+	}
+}
+
+// Run discovers the domains, then refreshes them every Interval and whenever
+// the filter changes, until ctx is cancelled
+func (r *Refresher) Run(ctx context.Context) {
+	if err := r.Discover(ctx); err != nil {
+		return
+	}
+
+	// Without an interval, only filter changes trigger a refresh
+	var tick <-chan time.Time
+	if r.Interval > 0 {
+		ticker := time.NewTicker(r.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+		case <-r.trigger:
+			r.Logger.Info("Refreshing domains after a configuration change")
+		}
+		if err := r.Refresh(); err != nil {
+			r.Logger.Warn("Domain refresh failed, keeping last known domains", "domains", r.domains(), "error", err)
+		}
+	}
+}
+
+// domains returns the last discovered domain list
+func (r *Refresher) domains() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// diff returns the entries only in next (added) and only in prev (removed)
+func diff(prev, next []string) (added, removed []string) {
+	prevSet := make(map[string]bool, len(prev))
+	for _, d := range prev {
+		prevSet[d] = true
+	}
+	nextSet := make(map[string]bool, len(next))
+	for _, d := range next {
+		nextSet[d] = true
+		if !prevSet[d] {
+			added = append(added, d)
+		}
+	}
+	for _, d := range prev {
+		if !nextSet[d] {
+			removed = append(removed, d)
+		}
+	}
+	return added, removed
+}
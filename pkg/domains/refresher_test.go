@@ -0,0 +1,145 @@
+package domains
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeLister returns a fixed domain list, failing the first failures calls
+type fakeLister struct {
+	mu       sync.Mutex
+	domains  []string
+	failures int
+	calls    int
+}
+
+func (l *fakeLister) ListDomains() ([]string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls++
+	if l.calls <= l.failures {
+		return nil, errors.New("simply.com unreachable")
+	}
+	return append([]string{}, l.domains...), nil
+}
+
+// newTestRefresher returns a refresher over lister recording every managed
+// domain list it reports
+func newTestRefresher(t *testing.T, lister Lister, filter Filter) (*Refresher, func() [][]string) {
+	t.Helper()
+	var mu sync.Mutex
+	var changes [][]string
+	r := NewRefresher(lister, filter, 0, slog.New(slog.NewTextHandler(io.Discard, nil)), func(domains []string) {
+		mu.Lock()
+		defer mu.Unlock()
+		changes = append(changes, domains)
+	})
+	return r, func() [][]string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([][]string{}, changes...)
+	}
+}
+
+func mustFilter(t *testing.T, include string) Filter {
+	t.Helper()
+	f, err := NewFilter(include, "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestRefresherSetFilter(t *testing.T) {
+	lister := &fakeLister{domains: []string{"example.com", "example.org", "example.net"}}
+	r, changes := newTestRefresher(t, lister, mustFilter(t, "example.com"))
+	if err := r.Refresh(); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+
+	if err := r.SetFilter(mustFilter(t, "example.org, example.net")); err != nil {
+		t.Fatalf("SetFilter() error = %v", err)
+	}
+	if got := strings.Join(r.domains(), ","); got != "example.net,example.org" {
+		t.Errorf("domains after SetFilter = %s, want example.net,example.org", got)
+	}
+
+	// A filter matching nothing is rejected and changes nothing
+	if err := r.SetFilter(mustFilter(t, "example.io")); err == nil {
+		t.Fatal("SetFilter() accepted a filter matching no domain")
+	}
+	if got := r.Filter(); !got.Match("example.org") || got.Match("example.io") {
+		t.Error("rejected filter replaced the running one")
+	}
+	if got := changes(); len(got) != 2 {
+		t.Errorf("managed domains changed %d times, want 2: %v", len(got), got)
+	}
+}
+
+func TestRefresherSetFilterBeforeDiscovery(t *testing.T) {
+	r, changes := newTestRefresher(t, &fakeLister{}, mustFilter(t, "example.com"))
+
+	// Nothing is listed yet, so the filter applies at the first discovery
+	if err := r.SetFilter(mustFilter(t, "example.io")); err != nil {
+		t.Fatalf("SetFilter() error = %v", err)
+	}
+	if !r.Filter().Match("example.io") {
+		t.Error("filter not replaced before discovery")
+	}
+	if got := changes(); len(got) != 0 {
+		t.Errorf("managed domains reported before discovery: %v", got)
+	}
+}
+
+func TestDiscoverRetriesUntilReachable(t *testing.T) {
+	lister := &fakeLister{domains: []string{"example.com"}, failures: 1}
+	r, changes := newTestRefresher(t, lister, Filter{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := r.Discover(ctx); err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+	if lister.calls != 2 {
+		t.Errorf("listed domains %d times, want 2", lister.calls)
+	}
+	if got := changes(); len(got) != 1 || strings.Join(got[0], ",") != "example.com" {
+		t.Errorf("managed domains = %v, want [example.com]", got)
+	}
+}
+
+func TestDiscoverStopsWhenCancelled(t *testing.T) {
+	lister := &fakeLister{failures: 1000}
+	r, changes := newTestRefresher(t, lister, Filter{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := r.Discover(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Discover() error = %v, want context.Canceled", err)
+	}
+	if got := changes(); len(got) != 0 {
+		t.Errorf("managed domains reported without a discovery: %v", got)
+	}
+}
+
+func TestRefreshKeepsDomainsOnFailure(t *testing.T) {
+	lister := &fakeLister{domains: []string{"example.com"}}
+	r, _ := newTestRefresher(t, lister, Filter{})
+	if err := r.Refresh(); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+
+	lister.failures = lister.calls + 1
+	if err := r.Refresh(); err == nil {
+		t.Fatal("Refresh() succeeded while Simply.com is unreachable")
+	}
+	if got := r.domains(); strings.Join(got, ",") != "example.com" {
+		t.Errorf("domains after a failed refresh = %v, want [example.com]", got)
+	}
+}
@@ -0,0 +1,208 @@
+package drift
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/metrics"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
+)
+
+var (
+	driftRecords = metrics.NewGaugeVec(
+		"simply_webhook_drift_records",
+		"Number of records changed out of band since the webhook applied them, by domain and kind.",
+		"domain", "kind",
+	)
+	driftChecks = metrics.NewCounterVec(
+		"simply_webhook_drift_checks_total",
+		"Number of drift checks by result (ok, drift, error).",
+		"result",
+	)
+)
+
+// Report is the result of a drift check over all tracked domains
+type Report struct {
+	Checked time.Time            `json:"checked"`
+	Drifted bool                 `json:"drifted"`
+	Zones   map[string][]Finding `json:"zones"`
+	Errors  map[string]string    `json:"errors,omitempty"`
+}
+
+// Detector periodically compares the live Simply.com zones with the records
+// the webhook last applied
+type Detector struct {
+	Tracker  *Tracker
+	Client   simply.API
+	Interval time.Duration
+	Logger   *slog.Logger
+
+	// LockZone, when set, is called before a domain is read and returns the
+	// function releasing it, so a check never compares a zone while a batch
+	// is being applied to it
+	LockZone func(ctx context.Context, domain string) (unlock func(), err error)
+
+	mu   sync.Mutex
+	last *Report
+	// gauged holds the domains drift gauges are exported for
+	gauged map[string]bool
+}
+
+// NewDetector creates a drift detector
+func NewDetector(tracker *Tracker, client simply.API, interval time.Duration, logger *slog.Logger) *Detector {
+	return &Detector{
+		Tracker:  tracker,
+		Client:   client,
+		Interval: interval,
+		Logger:   logger,
+	}
+}
+
+// Check runs a drift check over every tracked domain and stores the report
+func (d *Detector) Check() *Report {
+	report := &Report{
+		Checked: time.Now().UTC(),
+		Zones:   make(map[string][]Finding),
+		Errors:  make(map[string]string),
+	}
+
+	// Gauges are updated in place, so scrapes during a check never see them
+	// missing; only domains no longer tracked are removed
+	domains := d.Tracker.Domains()
+	d.mu.Lock()
+	tracked := make(map[string]bool, len(domains))
+	for _, domain := range domains {
+		tracked[domain] = true
+	}
+	for domain := range d.gauged {
+		if !tracked[domain] {
+			driftRecords.Delete(domain, KindModified)
+			driftRecords.Delete(domain, KindDeleted)
+			delete(d.gauged, domain)
+		}
+	}
+	d.mu.Unlock()
+
+	for _, domain := range domains {
+		findings, err := d.checkDomain(domain)
+		if err != nil {
+			d.Logger.Warn("Drift check failed for domain", "domain", domain, "error", err)
+			report.Errors[domain] = err.Error()
+			continue
+		}
+
+		counts := map[string]int{KindModified: 0, KindDeleted: 0}
+		for _, f := range findings {
+			counts[f.Kind]++
+			d.Logger.Warn("Record drifted from what the webhook applied",
+				"domain", domain, "kind", f.Kind, "name", f.Expected.Name, "type", f.Expected.Type,
+				"expected", f.Expected.Data, "actual", actualData(f.Actual))
+		}
+		for kind, n := range counts {
+			driftRecords.Set(float64(n), domain, kind)
+		}
+		d.mu.Lock()
+		if d.gauged == nil {
+			d.gauged = make(map[string]bool)
+		}
+		d.gauged[domain] = true
+		d.mu.Unlock()
+
+		if len(findings) > 0 {
+			report.Zones[domain] = findings
+			report.Drifted = true
+		}
+	}
+
+	// Save the record IDs learned during the check
+	if err := d.Tracker.Flush(); err != nil {
+		d.Logger.Error("Failed to save drift state", "error", err)
+	}
+
+	switch {
+	case len(report.Errors) > 0:
+		driftChecks.Inc("error")
+	case report.Drifted:
+		driftChecks.Inc("drift")
+	default:
+		driftChecks.Inc("ok")
+	}
+
+	d.mu.Lock()
+	d.last = report
+	d.mu.Unlock()
+	return report
+}
+
+// checkDomain compares the live records of domain with the applied ones,
+// holding the zone lock so no batch changes the zone meanwhile
+func (d *Detector) checkDomain(domain string) ([]Finding, error) {
+	if d.LockZone != nil {
+		unlock, err := d.LockZone(context.Background(), domain)
+		if err != nil {
+			return nil, fmt.Errorf("zone is locked by a running batch: %w", err)
+		}
+		defer unlock()
+	}
+
+	live, err := d.Client.ListRecords(domain)
+	if err != nil {
+		return nil, err
+	}
+	return d.Tracker.Check(domain, live), nil
+}
+
+func actualData(r *simply.Record) string {
+	if r == nil {
+		return ""
+	}
+	return r.Data
+}
+
+// Run checks for drift every Interval until ctx is cancelled
+func (d *Detector) Run(ctx context.Context) {
+	if d.Interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.Check()
+		}
+	}
+}
+
+// ServeHTTP returns the latest drift report as JSON, running a check first
+// if none has run yet or ?refresh=true is passed
+func (d *Detector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	report := d.last
+	d.mu.Unlock()
+
+	if report == nil || r.URL.Query().Get("refresh") == "true" {
+		report = d.Check()
+	}
+
+	jsonData, err := json.Marshal(report)
+	if err != nil {
+		d.Logger.Error("Failed to marshal drift report", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(jsonData)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
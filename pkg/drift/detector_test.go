@@ -0,0 +1,160 @@
+package drift
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/metrics"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
+)
+
+// fakeAPI serves fixed live records per domain and checks that a domain is
+// only read while its zone lock is held
+type fakeAPI struct {
+	mu      sync.Mutex
+	records map[string][]simply.Record
+	locked  map[string]bool
+	listed  []string
+	// unlocked lists the domains read without holding their lock
+	unlocked []string
+}
+
+func (f *fakeAPI) ListDomains() ([]string, error) { return nil, nil }
+
+func (f *fakeAPI) ListRecords(domain string) ([]simply.Record, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.listed = append(f.listed, domain)
+	if !f.locked[domain] {
+		f.unlocked = append(f.unlocked, domain)
+	}
+	return f.records[domain], nil
+}
+
+func (f *fakeAPI) Apply(simply.Mutation) error { return nil }
+func (f *fakeAPI) Status() simply.Status       { return simply.Status{} }
+func (f *fakeAPI) Ping() error                 { return nil }
+
+// lockZone locks domain in f, failing for the domains in busy
+func (f *fakeAPI) lockZone(busy ...string) func(context.Context, string) (func(), error) {
+	return func(_ context.Context, domain string) (func(), error) {
+		for _, b := range busy {
+			if b == domain {
+				return nil, context.DeadlineExceeded
+			}
+		}
+		f.mu.Lock()
+		f.locked[domain] = true
+		f.mu.Unlock()
+		return func() {
+			f.mu.Lock()
+			f.locked[domain] = false
+			f.mu.Unlock()
+		}, nil
+	}
+}
+
+func newTestDetector(t *testing.T, api *fakeAPI, applied ...simply.Mutation) *Detector {
+	t.Helper()
+	tracker, err := NewTracker("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range applied {
+		tracker.Record(m)
+	}
+	return NewDetector(tracker, api, 0, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func create(domain string, id int, name, data string) simply.Mutation {
+	return simply.Mutation{Action: simply.ActionCreate, Domain: domain, Record: simply.Record{ID: id, Name: name, Type: "A", Data: data, TTL: 3600}}
+}
+
+// gauge returns the drift gauge of domain and kind, and whether it is exported
+func gauge(t *testing.T, domain, kind string) (float64, bool) {
+	t.Helper()
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != "simply_webhook_drift_records" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["domain"] == domain && labels["kind"] == kind {
+				return m.GetGauge().GetValue(), true
+			}
+		}
+	}
+	return 0, false
+}
+
+func TestCheckHoldsZoneLock(t *testing.T) {
+	api := &fakeAPI{
+		records: map[string][]simply.Record{
+			"example.com": {{ID: 1, Name: "www", Type: "A", Data: "192.0.2.1", TTL: 3600}},
+			"example.org": {{ID: 2, Name: "www", Type: "A", Data: "192.0.2.2", TTL: 3600}},
+		},
+		locked: make(map[string]bool),
+	}
+	d := newTestDetector(t, api, create("example.com", 1, "www", "192.0.2.1"), create("example.org", 2, "www", "192.0.2.2"))
+	d.LockZone = api.lockZone("example.org")
+
+	report := d.Check()
+	if len(api.unlocked) != 0 {
+		t.Errorf("domains read without their zone lock: %v", api.unlocked)
+	}
+	if fmt.Sprint(api.listed) != "[example.com]" {
+		t.Errorf("listed %v, want only example.com as example.org is busy", api.listed)
+	}
+	if _, ok := report.Errors["example.org"]; !ok || report.Drifted {
+		t.Errorf("report = %+v, want an error for the busy example.org and no drift", report)
+	}
+	for domain, locked := range api.locked {
+		if locked {
+			t.Errorf("zone lock of %s not released", domain)
+		}
+	}
+}
+
+func TestCheckUpdatesGaugesInPlace(t *testing.T) {
+	api := &fakeAPI{
+		records: map[string][]simply.Record{
+			"gauge.example": {{ID: 1, Name: "www", Type: "A", Data: "192.0.2.9", TTL: 3600}},
+		},
+		locked: make(map[string]bool),
+	}
+	d := newTestDetector(t, api, create("gauge.example", 1, "www", "192.0.2.1"))
+
+	if report := d.Check(); !report.Drifted {
+		t.Fatalf("Check() = %+v, want drift", report)
+	}
+	if v, ok := gauge(t, "gauge.example", KindModified); !ok || v != 1 {
+		t.Errorf("modified gauge = %v (exported %v), want 1", v, ok)
+	}
+
+	// A failing check keeps the last values rather than dropping them
+	d.LockZone = func(context.Context, string) (func(), error) { return nil, errors.New("busy") }
+	d.Check()
+	if v, ok := gauge(t, "gauge.example", KindModified); !ok || v != 1 {
+		t.Errorf("modified gauge after a failed check = %v (exported %v), want 1", v, ok)
+	}
+	d.LockZone = nil
+
+	// Once the domain is no longer tracked its gauges go away
+	d.Tracker.Record(simply.Mutation{Action: simply.ActionDelete, Domain: "gauge.example", Record: simply.Record{ID: 1}})
+	d.Check()
+	if _, ok := gauge(t, "gauge.example", KindModified); ok {
+		t.Error("gauge of an untracked domain still exported")
+	}
+}
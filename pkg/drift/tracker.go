@@ -0,0 +1,229 @@
+package drift
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/zone"
+)
+
+// Applied is a record as last written to Simply.com by the webhook
+type Applied struct {
+	// ID is the Simply.com record ID; 0 until learned for created records
+	ID       int       `json:"id,omitempty"`
+	Name     string    `json:"name"`
+	Type     string    `json:"type"`
+	Data     string    `json:"data"`
+	TTL      int       `json:"ttl"`
+	Priority int       `json:"priority,omitempty"`
+	Applied  time.Time `json:"applied"`
+}
+
+func (a Applied) matches(r simply.Record, domain string) bool {
+	return a.Name == zone.RelativeName(r.Name, domain) && strings.EqualFold(a.Type, r.Type) && a.Data == r.Data
+}
+
+// Tracker remembers every record the webhook applied, optionally persisting
+// them to a JSON file so drift can still be detected after a restart. Changes
+// are kept in memory until Flush, so a batch writes the file once.
+type Tracker struct {
+	path string
+
+	mu      sync.Mutex
+	applied map[string][]Applied
+	dirty   bool
+}
+
+// NewTracker creates a tracker, loading the state file at path if it exists.
+// An empty path keeps the state in memory only.
+func NewTracker(path string) (*Tracker, error) {
+	t := &Tracker{path: path, applied: make(map[string][]Applied)}
+	if path == "" {
+		return t, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read drift state: %w", err)
+	}
+	if err := json.Unmarshal(data, &t.applied); err != nil {
+		return nil, fmt.Errorf("failed to parse drift state: %w", err)
+	}
+	return t, nil
+}
+
+// Record updates the tracked state after a mutation was applied
+// successfully. The change is persisted by the next Flush.
+func (t *Tracker) Record(m simply.Mutation) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	records := t.applied[m.Domain]
+
+	// Drop the state of the record being replaced or deleted
+	if m.Action != simply.ActionCreate {
+		kept := records[:0]
+		for _, a := range records {
+			if (m.Record.ID != 0 && a.ID == m.Record.ID) || (m.Before != nil && a.matches(*m.Before, m.Domain)) {
+				continue
+			}
+			kept = append(kept, a)
+		}
+		records = kept
+	}
+
+	if m.Action != simply.ActionDelete {
+		records = append(records, Applied{
+			ID:       m.Record.ID,
+			Name:     zone.RelativeName(m.Record.Name, m.Domain),
+			Type:     strings.ToUpper(m.Record.Type),
+			Data:     m.Record.Data,
+			TTL:      m.Record.TTL,
+			Priority: m.Record.Priority,
+			Applied:  time.Now().UTC(),
+		})
+	}
+
+	if len(records) == 0 {
+		delete(t.applied, m.Domain)
+	} else {
+		t.applied[m.Domain] = records
+	}
+	t.dirty = true
+}
+
+// Flush persists the state if it changed since the last Flush
+func (t *Tracker) Flush() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.save()
+}
+
+// save persists the state if it changed; the caller must hold t.mu
+func (t *Tracker) save() error {
+	if t.path == "" || !t.dirty {
+		return nil
+	}
+	data, err := json.Marshal(t.applied)
+	if err != nil {
+		return fmt.Errorf("failed to marshal drift state: %w", err)
+	}
+	tmp := t.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write drift state: %w", err)
+	}
+	if err := os.Rename(tmp, t.path); err != nil {
+		return fmt.Errorf("failed to write drift state: %w", err)
+	}
+	t.dirty = false
+	return nil
+}
+
+// Finding kinds
+const (
+	KindModified = "modified"
+	KindDeleted  = "deleted"
+)
+
+// Finding is a record changed out of band since the webhook applied it
+type Finding struct {
+	Kind     string         `json:"kind"`
+	Expected Applied        `json:"expected"`
+	Actual   *simply.Record `json:"actual,omitempty"`
+}
+
+// Check compares the live records of a domain with the tracked state.
+// Record IDs of created records are learned from the live zone on the way.
+func (t *Tracker) Check(domain string, live []simply.Record) []Finding {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	byID := make(map[int]simply.Record, len(live))
+	for _, r := range live {
+		byID[r.ID] = r
+	}
+
+	var findings []Finding
+	records := t.applied[domain]
+	for i, a := range records {
+		if a.ID == 0 {
+			for _, r := range live {
+				if a.matches(r, domain) {
+					records[i].ID = r.ID
+					a.ID = r.ID
+					t.dirty = true
+					break
+				}
+			}
+		}
+	}
+
+	// Live records accounted for by a tracked record, so a record gone from
+	// a set sharing its name and type is not mistaken for an edit of another
+	tracked := make(map[int]bool, len(records))
+	for _, a := range records {
+		if _, found := byID[a.ID]; found && a.ID != 0 {
+			tracked[a.ID] = true
+		}
+	}
+
+	for _, a := range records {
+		actual, found := byID[a.ID]
+		if a.ID == 0 || !found {
+			// The record is gone; if an untracked record with its name and
+			// type exists, the data was edited
+			var edited *simply.Record
+			for _, r := range live {
+				if !tracked[r.ID] && zone.RelativeName(r.Name, domain) == a.Name && strings.EqualFold(r.Type, a.Type) {
+					r := r
+					edited = &r
+					tracked[r.ID] = true
+					break
+				}
+			}
+			if edited != nil {
+				findings = append(findings, Finding{Kind: KindModified, Expected: a, Actual: edited})
+			} else {
+				findings = append(findings, Finding{Kind: KindDeleted, Expected: a})
+			}
+			continue
+		}
+
+		if !a.matches(actual, domain) || a.TTL != actual.TTL || a.Priority != actual.Priority {
+			findings = append(findings, Finding{Kind: KindModified, Expected: a, Actual: &actual})
+		}
+	}
+
+	// Learned IDs are persisted with the next Flush
+
+	sort.Slice(findings, func(i, j int) bool {
+		if findings[i].Expected.Name != findings[j].Expected.Name {
+			return findings[i].Expected.Name < findings[j].Expected.Name
+		}
+		return findings[i].Expected.Type < findings[j].Expected.Type
+	})
+	return findings
+}
+
+// Domains returns the domains with tracked records
+func (t *Tracker) Domains() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	domains := make([]string, 0, len(t.applied))
+	for domain := range t.applied {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	return domains
+}
@@ -0,0 +1,228 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
+)
+
+const (
+	// fileExt is the extension of the journal of a batch in progress
+	fileExt = ".journal"
+	// incompleteExt is appended to journals of interrupted batches once
+	// reported, and to journals of batches that failed partway
+	incompleteExt = ".incomplete"
+)
+
+// Entry types
+const (
+	EntryBegin  = "begin"
+	EntryDone   = "done"
+	EntryFailed = "failed"
+)
+
+// Entry is a single line of a batch journal
+type Entry struct {
+	Time  time.Time `json:"time"`
+	Type  string    `json:"type"`
+	Batch string    `json:"batch"`
+	// Mutations is the full plan, written with the begin entry
+	Mutations []simply.Mutation `json:"mutations,omitempty"`
+	// Index is the position in the plan of a done or failed mutation
+	Index int    `json:"index"`
+	Error string `json:"error,omitempty"`
+}
+
+// Journal is an on-disk write-ahead log of ApplyChanges batches. Every batch
+// is written to its own file before any mutation is sent to Simply.com, and
+// the file is removed once the batch succeeds. A batch that failed partway is
+// kept with an .incomplete suffix; a .journal file left behind means the
+// process died in the middle of a batch. Recovery only reports what was left
+// undone: ExternalDNS plans the remaining changes again on its next sync.
+type Journal struct {
+	dir string
+}
+
+// Open opens a journal in dir, creating the directory if needed
+func Open(dir string) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create journal directory: %w", err)
+	}
+	return &Journal{dir: dir}, nil
+}
+
+// Batch is the journal of a single batch in progress
+type Batch struct {
+	id   string
+	path string
+
+	mu     sync.Mutex
+	file   *os.File
+	failed bool
+}
+
+// Begin records the full plan of a batch and syncs it to disk before
+// returning, so the plan survives a crash during the first mutation
+func (j *Journal) Begin(batchID string, mutations []simply.Mutation) (*Batch, error) {
+	path := filepath.Join(j.dir, batchID+fileExt)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create journal for batch %s: %w", batchID, err)
+	}
+
+	b := &Batch{id: batchID, path: path, file: file}
+	if err := b.write(Entry{Type: EntryBegin, Mutations: mutations}); err != nil {
+		file.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *Batch) write(entry Entry) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entry.Time = time.Now().UTC()
+	entry.Batch = b.id
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal entry: %w", err)
+	}
+	if _, err := b.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal entry: %w", err)
+	}
+	if err := b.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync journal: %w", err)
+	}
+	return nil
+}
+
+// Done records that the mutation at index was applied
+func (b *Batch) Done(index int) error {
+	return b.write(Entry{Type: EntryDone, Index: index})
+}
+
+// Failed records that the mutation at index was rejected by Simply.com
+func (b *Batch) Failed(index int, err error) error {
+	b.mu.Lock()
+	b.failed = true
+	b.mu.Unlock()
+	return b.write(Entry{Type: EntryFailed, Index: index, Error: err.Error()})
+}
+
+// End closes the journal of a batch that finished without the process dying.
+// The journal of a successful batch is removed. The journal of a batch with a
+// failed mutation is kept with an .incomplete suffix, as the zone may be left
+// half-applied; End returns its path.
+func (b *Batch) End() (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.file.Close(); err != nil {
+		return "", fmt.Errorf("failed to close journal: %w", err)
+	}
+	if b.failed {
+		kept := b.path + incompleteExt
+		if err := os.Rename(b.path, kept); err != nil {
+			return "", fmt.Errorf("failed to mark journal as incomplete: %w", err)
+		}
+		return kept, nil
+	}
+	if err := os.Remove(b.path); err != nil {
+		return "", fmt.Errorf("failed to remove journal: %w", err)
+	}
+	return "", nil
+}
+
+// Incomplete describes a batch that was interrupted by a crash
+type Incomplete struct {
+	Batch   string            `json:"batch"`
+	Started time.Time         `json:"started"`
+	File    string            `json:"file"`
+	Done    []simply.Mutation `json:"done,omitempty"`
+	Failed  []simply.Mutation `json:"failed,omitempty"`
+	// Pending lists the mutations never sent, or sent without the outcome
+	// reaching the journal
+	Pending []simply.Mutation `json:"pending,omitempty"`
+}
+
+// Recover reads the journals left behind by interrupted batches. Each one is
+// renamed with an .incomplete suffix so it is reported only once but kept for
+// operators to inspect.
+func (j *Journal) Recover() ([]Incomplete, error) {
+	paths, err := filepath.Glob(filepath.Join(j.dir, "*"+fileExt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list journals: %w", err)
+	}
+	sort.Strings(paths)
+
+	var incomplete []Incomplete
+	for _, path := range paths {
+		batch, err := readBatch(path)
+		if err != nil {
+			return incomplete, err
+		}
+
+		renamed := path + incompleteExt
+		if err := os.Rename(path, renamed); err != nil {
+			return incomplete, fmt.Errorf("failed to mark journal %s as incomplete: %w", path, err)
+		}
+		batch.File = renamed
+		incomplete = append(incomplete, batch)
+	}
+	return incomplete, nil
+}
+
+// readBatch replays a journal file into a summary of what was left undone
+func readBatch(path string) (Incomplete, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Incomplete{}, fmt.Errorf("failed to open journal %s: %w", path, err)
+	}
+	defer file.Close()
+
+	result := Incomplete{Batch: strings.TrimSuffix(filepath.Base(path), fileExt)}
+	var plan []simply.Mutation
+	outcome := make(map[int]string)
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A torn final line is expected when the process died mid-write
+			break
+		}
+		switch entry.Type {
+		case EntryBegin:
+			plan = entry.Mutations
+			result.Started = entry.Time
+		case EntryDone, EntryFailed:
+			outcome[entry.Index] = entry.Type
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Incomplete{}, fmt.Errorf("failed to read journal %s: %w", path, err)
+	}
+
+	for i, m := range plan {
+		switch outcome[i] {
+		case EntryDone:
+			result.Done = append(result.Done, m)
+		case EntryFailed:
+			result.Failed = append(result.Failed, m)
+		default:
+			result.Pending = append(result.Pending, m)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,127 @@
+package journal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
+)
+
+func testPlan() []simply.Mutation {
+	return []simply.Mutation{
+		{Action: simply.ActionCreate, Domain: "example.com", Record: simply.Record{Name: "www", Type: "A", Data: "192.0.2.1"}},
+		{Action: simply.ActionUpdate, Domain: "example.com", Record: simply.Record{ID: 2, Name: "api", Type: "A", Data: "192.0.2.2"}},
+		{Action: simply.ActionDelete, Domain: "example.com", Record: simply.Record{ID: 3, Name: "old", Type: "A", Data: "192.0.2.3"}},
+	}
+}
+
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestSuccessfulBatchRemovesJournal(t *testing.T) {
+	dir := t.TempDir()
+	j, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	b, err := j.Begin("batch-1", testPlan())
+	if err != nil {
+		t.Fatalf("Begin() error = %v", err)
+	}
+	if _, err := j.Begin("batch-1", testPlan()); err == nil {
+		t.Error("Begin() reused the journal of a batch in progress")
+	}
+	for i := range testPlan() {
+		if err := b.Done(i); err != nil {
+			t.Fatalf("Done(%d) error = %v", i, err)
+		}
+	}
+	kept, err := b.End()
+	if err != nil || kept != "" {
+		t.Fatalf("End() = %q, %v, want the journal removed", kept, err)
+	}
+	if names := listDir(t, dir); len(names) != 0 {
+		t.Errorf("journal directory = %v, want empty", names)
+	}
+}
+
+func TestFailedBatchKeepsIncompleteJournal(t *testing.T) {
+	dir := t.TempDir()
+	j, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	b, err := j.Begin("batch-2", testPlan())
+	if err != nil {
+		t.Fatalf("Begin() error = %v", err)
+	}
+	b.Done(0)
+	b.Failed(1, errors.New("record not found"))
+	kept, err := b.End()
+	if err != nil {
+		t.Fatalf("End() error = %v", err)
+	}
+	if want := filepath.Join(dir, "batch-2.journal.incomplete"); kept != want {
+		t.Errorf("End() kept %q, want %q", kept, want)
+	}
+
+	// Failed batches ended normally are not reported again as crashes
+	incomplete, err := j.Recover()
+	if err != nil || len(incomplete) != 0 {
+		t.Errorf("Recover() = %+v, %v, want nothing", incomplete, err)
+	}
+}
+
+func TestRecoverInterruptedBatch(t *testing.T) {
+	dir := t.TempDir()
+	j, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	// The process dies after the first mutation, midway through a journal line
+	b, err := j.Begin("batch-3", testPlan())
+	if err != nil {
+		t.Fatalf("Begin() error = %v", err)
+	}
+	b.Done(0)
+	b.file.WriteString(`{"type":"done","ind`)
+	b.file.Close()
+
+	incomplete, err := j.Recover()
+	if err != nil {
+		t.Fatalf("Recover() error = %v", err)
+	}
+	if len(incomplete) != 1 {
+		t.Fatalf("Recover() = %d batches, want 1", len(incomplete))
+	}
+	got := incomplete[0]
+	if got.Batch != "batch-3" || got.Started.IsZero() || got.File != filepath.Join(dir, "batch-3.journal.incomplete") {
+		t.Errorf("Recover() = %+v", got)
+	}
+	if len(got.Done) != 1 || got.Done[0].Record.Name != "www" {
+		t.Errorf("Done = %+v, want the create of www", got.Done)
+	}
+	if len(got.Failed) != 0 || len(got.Pending) != 2 || got.Pending[0].Record.Name != "api" || got.Pending[1].Record.Name != "old" {
+		t.Errorf("Failed = %+v, Pending = %+v, want api and old pending", got.Failed, got.Pending)
+	}
+
+	// Reported once only
+	if again, err := j.Recover(); err != nil || len(again) != 0 {
+		t.Errorf("second Recover() = %+v, %v, want nothing", again, err)
+	}
+}
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds the webhook's metrics, along with the standard Go runtime
+// and process metrics
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler returns an HTTP handler exposing the registry in Prometheus format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// CounterVec is a monotonically increasing metric partitioned by labels
+type CounterVec struct {
+	v *prometheus.CounterVec
+}
+
+// NewCounterVec creates a counter and registers it in the registry
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{v: prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labels)}
+	Registry.MustRegister(c.v)
+	return c
+}
+
+// Inc increments the counter for the given label values by one
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.v.WithLabelValues(labelValues...).Inc()
+}
+
+// Add increments the counter for the given label values by delta, which
+// must not be negative
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	c.v.WithLabelValues(labelValues...).Add(delta)
+}
+
+// GaugeVec is a metric that can go up and down, partitioned by labels
+type GaugeVec struct {
+	v *prometheus.GaugeVec
+}
+
+// NewGaugeVec creates a gauge and registers it in the registry
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{v: prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, labels)}
+	Registry.MustRegister(g.v)
+	return g
+}
+
+// Set sets the gauge for the given label values
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.v.WithLabelValues(labelValues...).Set(value)
+}
+
+// Add adds delta (which may be negative) to the gauge for the given label values
+func (g *GaugeVec) Add(delta float64, labelValues ...string) {
+	g.v.WithLabelValues(labelValues...).Add(delta)
+}
+
+// Reset removes all label combinations from the gauge
+func (g *GaugeVec) Reset() {
+	g.v.Reset()
+}
+
+// Delete removes the gauge for the given label values
+func (g *GaugeVec) Delete(labelValues ...string) {
+	g.v.DeleteLabelValues(labelValues...)
+}
@@ -0,0 +1,217 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/metrics"
+)
+
+const (
+	// SignatureHeader carries the hex HMAC-SHA256 of the payload, prefixed
+	// with "sha256=", when a secret is configured
+	SignatureHeader = "X-Simply-Signature"
+
+	DefaultRetries = 3
+	DefaultTimeout = 10 * time.Second
+	// InitialBackoff is the delay before the first retry; it doubles after
+	// every further attempt
+	InitialBackoff = time.Second
+	// QueueSize bounds the number of notifications waiting to be sent
+	QueueSize = 100
+)
+
+var notifications = metrics.NewCounterVec(
+	"simply_webhook_notifications_total",
+	"Number of batch notifications by result (sent, failed, dropped).",
+	"result",
+)
+
+// Notifier posts batch summaries to HTTP endpoints in the background
+type Notifier struct {
+	URLs       []string
+	Secret     string
+	Template   *template.Template
+	Retries    int
+	HTTPClient *http.Client
+	Logger     *slog.Logger
+
+	queue  chan *Summary
+	mu     sync.Mutex
+	closed bool
+	done   chan struct{}
+}
+
+// NewNotifier creates a notifier for the given URLs and starts its worker
+func NewNotifier(urls []string, logger *slog.Logger) *Notifier {
+	n := &Notifier{
+		URLs:    urls,
+		Retries: DefaultRetries,
+		HTTPClient: &http.Client{
+			Timeout: DefaultTimeout,
+		},
+		Logger: logger,
+		queue:  make(chan *Summary, QueueSize),
+		done:   make(chan struct{}),
+	}
+	go n.run()
+	return n
+}
+
+// LoadTemplate parses a text/template file used to render the JSON payload.
+// The template is executed with the Summary; the json function encodes any
+// value as JSON.
+func LoadTemplate(path string) (*template.Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notification template: %w", err)
+	}
+	tmpl, err := template.New("notification").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse notification template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// Notify queues a summary for delivery without blocking. Summaries are
+// dropped when the queue is full or the notifier is closed.
+func (n *Notifier) Notify(s *Summary) {
+	s.sort()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		notifications.Inc("dropped")
+		return
+	}
+	select {
+	case n.queue <- s:
+	default:
+		notifications.Inc("dropped")
+		n.Logger.Warn("Notification queue full, dropping batch summary", "batch", s.Batch)
+	}
+}
+
+// Close stops accepting summaries and waits for queued ones to be delivered
+// until ctx expires
+func (n *Notifier) Close(ctx context.Context) error {
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		close(n.queue)
+	}
+	n.mu.Unlock()
+
+	select {
+	case <-n.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d notifications not delivered: %w", len(n.queue), ctx.Err())
+	}
+}
+
+func (n *Notifier) run() {
+	defer close(n.done)
+	for s := range n.queue {
+		payload, err := n.render(s)
+		if err != nil {
+			notifications.Inc("failed")
+			n.Logger.Error("Failed to render notification", "batch", s.Batch, "error", err)
+			continue
+		}
+		for _, url := range n.URLs {
+			if err := n.deliver(url, payload); err != nil {
+				notifications.Inc("failed")
+				n.Logger.Error("Failed to send notification", "batch", s.Batch, "url", url, "error", err)
+				continue
+			}
+			notifications.Inc("sent")
+			n.Logger.Debug("Sent notification", "batch", s.Batch, "url", url)
+		}
+	}
+}
+
+// render builds the JSON payload of a summary
+func (n *Notifier) render(s *Summary) ([]byte, error) {
+	if n.Template == nil {
+		return json.Marshal(s)
+	}
+	var buf bytes.Buffer
+	if err := n.Template.Execute(&buf, s); err != nil {
+		return nil, err
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("template did not produce valid JSON")
+	}
+	return buf.Bytes(), nil
+}
+
+// deliver posts the payload, retrying network errors, 429 and 5xx responses
+// with exponential backoff
+func (n *Notifier) deliver(url string, payload []byte) error {
+	backoff := InitialBackoff
+	var err error
+	for attempt := 0; attempt <= n.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		var retry bool
+		retry, err = n.post(url, payload)
+		if err == nil || !retry {
+			return err
+		}
+		n.Logger.Warn("Notification attempt failed", "url", url, "attempt", attempt+1, "error", err)
+	}
+	return err
+}
+
+// post sends the payload once, reporting whether a failure is worth retrying
+func (n *Notifier) post(url string, payload []byte) (bool, error) {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.Secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(n.Secret, payload))
+	}
+
+	resp, err := n.HTTPClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("endpoint responded with status %d", resp.StatusCode)
+}
+
+// Sign returns the hex HMAC-SHA256 of payload with secret, as sent in the
+// signature header
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
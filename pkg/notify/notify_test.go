@@ -0,0 +1,197 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func testSummary() *Summary {
+	s := NewSummary("batch-1")
+	s.Add(simply.Mutation{Action: simply.ActionCreate, Domain: "example.org", Record: simply.Record{Name: "www", Type: "A", Data: "192.0.2.1", TTL: 300}}, nil)
+	s.Add(simply.Mutation{Action: simply.ActionUpdate, Domain: "example.com", Record: simply.Record{Name: "api", Type: "A", Data: "192.0.2.2"}}, nil)
+	s.Add(simply.Mutation{Action: simply.ActionDelete, Domain: "example.com", Record: simply.Record{Name: "old", Type: "A", Data: "192.0.2.3"}}, errors.New("record not found"))
+	return s
+}
+
+func TestSummary(t *testing.T) {
+	s := NewSummary("batch-1")
+	if !s.Empty() || !s.Success {
+		t.Fatalf("NewSummary() = %+v, want an empty successful summary", s)
+	}
+
+	s = testSummary()
+	s.sort()
+	if s.Empty() || s.Success || s.Created != 1 || s.Updated != 1 || s.Deleted != 0 || s.Failed != 1 {
+		t.Errorf("Summary = %+v", s)
+	}
+	if len(s.Domains) != 2 || s.Domains[0].Domain != "example.com" || s.Domains[1].Domain != "example.org" {
+		t.Fatalf("Domains = %+v, want example.com and example.org in order", s.Domains)
+	}
+	failed := s.Domains[0].Failed
+	if len(failed) != 1 || failed[0].Action != simply.ActionDelete || failed[0].Error != "record not found" {
+		t.Errorf("Failed = %+v", failed)
+	}
+	if created := s.Domains[1].Created; len(created) != 1 || created[0].Action != "" || created[0].TTL != 300 {
+		t.Errorf("Created = %+v", created)
+	}
+
+	// Empty lists are encoded as [] rather than null
+	payload, _ := json.Marshal(s.Domains[1])
+	var decoded map[string]json.RawMessage
+	json.Unmarshal(payload, &decoded)
+	if string(decoded["deleted"]) != "[]" {
+		t.Errorf("deleted encoded as %s, want []", decoded["deleted"])
+	}
+}
+
+// receiver records the notifications posted to it, answering with the
+// queued statuses first and 200 after that
+type receiver struct {
+	mu        sync.Mutex
+	statuses  []int
+	payloads  [][]byte
+	headers   []http.Header
+	responses int
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	body, _ := io.ReadAll(req.Body)
+	r.payloads = append(r.payloads, body)
+	r.headers = append(r.headers, req.Header.Clone())
+	if r.responses < len(r.statuses) {
+		w.WriteHeader(r.statuses[r.responses])
+	}
+	r.responses++
+}
+
+func newReceiver(t *testing.T, statuses ...int) (*receiver, string) {
+	t.Helper()
+	r := &receiver{statuses: statuses}
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return r, server.URL
+}
+
+func TestNotifierSignsPayload(t *testing.T) {
+	r, url := newReceiver(t)
+	n := NewNotifier([]string{url}, discardLogger())
+	n.Secret = "s3cret"
+
+	n.Notify(testSummary())
+	if err := n.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if len(r.payloads) != 1 {
+		t.Fatalf("received %d notifications, want 1", len(r.payloads))
+	}
+	if got := r.headers[0].Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if got, want := r.headers[0].Get(SignatureHeader), "sha256="+Sign("s3cret", r.payloads[0]); got != want {
+		t.Errorf("%s = %q, want %q", SignatureHeader, got, want)
+	}
+
+	var s Summary
+	if err := json.Unmarshal(r.payloads[0], &s); err != nil {
+		t.Fatalf("invalid payload: %v", err)
+	}
+	if s.Batch != "batch-1" || s.Success || s.Failed != 1 || len(s.Domains) != 2 {
+		t.Errorf("payload = %+v", s)
+	}
+}
+
+func TestNotifierRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		want     int
+	}{
+		{name: "server errors are retried", statuses: []int{http.StatusServiceUnavailable}, want: 2},
+		{name: "client errors are not retried", statuses: []int{http.StatusBadRequest}, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, url := newReceiver(t, tt.statuses...)
+			n := NewNotifier([]string{url}, discardLogger())
+
+			n.Notify(testSummary())
+			if err := n.Close(context.Background()); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+			if r.responses != tt.want {
+				t.Errorf("received %d attempts, want %d", r.responses, tt.want)
+			}
+			if r.headers[0].Get(SignatureHeader) != "" {
+				t.Errorf("payload signed without a secret")
+			}
+		})
+	}
+}
+
+func TestNotifierTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "template.json")
+	os.WriteFile(path, []byte(`{"text": {{ printf "batch %s: %d failed" .Batch .Failed | json }}}`), 0o600)
+	tmpl, err := LoadTemplate(path)
+	if err != nil {
+		t.Fatalf("LoadTemplate() error = %v", err)
+	}
+
+	r, url := newReceiver(t)
+	n := NewNotifier([]string{url}, discardLogger())
+	n.Template = tmpl
+	n.Notify(testSummary())
+	n.Close(context.Background())
+
+	if len(r.payloads) != 1 || string(r.payloads[0]) != `{"text": "batch batch-1: 1 failed"}` {
+		t.Errorf("payloads = %q", r.payloads)
+	}
+}
+
+func TestNotifierRejectsInvalidTemplateOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "template.json")
+	os.WriteFile(path, []byte(`batch {{ .Batch }}`), 0o600)
+	tmpl, err := LoadTemplate(path)
+	if err != nil {
+		t.Fatalf("LoadTemplate() error = %v", err)
+	}
+
+	r, url := newReceiver(t)
+	n := NewNotifier([]string{url}, discardLogger())
+	n.Template = tmpl
+	n.Notify(testSummary())
+	n.Close(context.Background())
+
+	if len(r.payloads) != 0 {
+		t.Errorf("posted %q, want nothing sent for a payload that is not JSON", r.payloads)
+	}
+}
+
+func TestNotifyAfterClose(t *testing.T) {
+	r, url := newReceiver(t)
+	n := NewNotifier([]string{url}, discardLogger())
+	n.Close(context.Background())
+	n.Notify(testSummary())
+
+	if len(r.payloads) != 0 {
+		t.Errorf("received %d notifications after Close(), want 0", len(r.payloads))
+	}
+}
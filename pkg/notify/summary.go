@@ -0,0 +1,103 @@
+package notify
+
+import (
+	"sort"
+	"time"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
+)
+
+// Change is a single record change in a notification
+type Change struct {
+	// Action is only set on failed changes
+	Action string `json:"action,omitempty"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Data   string `json:"data"`
+	TTL    int    `json:"ttl,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// DomainSummary lists the changes made to one domain in a batch
+type DomainSummary struct {
+	Domain  string   `json:"domain"`
+	Created []Change `json:"created"`
+	Updated []Change `json:"updated"`
+	Deleted []Change `json:"deleted"`
+	Failed  []Change `json:"failed"`
+}
+
+// Summary describes the outcome of an ApplyChanges batch
+type Summary struct {
+	Batch    string          `json:"batch"`
+	Time     time.Time       `json:"time"`
+	Success  bool            `json:"success"`
+	Created  int             `json:"created"`
+	Updated  int             `json:"updated"`
+	Deleted  int             `json:"deleted"`
+	Failed   int             `json:"failed"`
+	Domains  []DomainSummary `json:"domains"`
+	byDomain map[string]int
+}
+
+// NewSummary creates an empty summary for a batch
+func NewSummary(batch string) *Summary {
+	return &Summary{
+		Batch:    batch,
+		Time:     time.Now().UTC(),
+		Success:  true,
+		byDomain: make(map[string]int),
+	}
+}
+
+// Add records the outcome of a mutation
+func (s *Summary) Add(m simply.Mutation, err error) {
+	i, ok := s.byDomain[m.Domain]
+	if !ok {
+		s.Domains = append(s.Domains, DomainSummary{
+			Domain:  m.Domain,
+			Created: []Change{},
+			Updated: []Change{},
+			Deleted: []Change{},
+			Failed:  []Change{},
+		})
+		i = len(s.Domains) - 1
+		s.byDomain[m.Domain] = i
+	}
+	d := &s.Domains[i]
+
+	c := Change{Name: m.Record.Name, Type: m.Record.Type, Data: m.Record.Data, TTL: m.Record.TTL}
+	if err != nil {
+		c.Action = m.Action
+		c.Error = err.Error()
+		d.Failed = append(d.Failed, c)
+		s.Failed++
+		s.Success = false
+		return
+	}
+
+	switch m.Action {
+	case simply.ActionCreate:
+		d.Created = append(d.Created, c)
+		s.Created++
+	case simply.ActionUpdate:
+		d.Updated = append(d.Updated, c)
+		s.Updated++
+	case simply.ActionDelete:
+		d.Deleted = append(d.Deleted, c)
+		s.Deleted++
+	}
+}
+
+// Empty reports whether no mutation was recorded
+func (s *Summary) Empty() bool {
+	return len(s.Domains) == 0
+}
+
+// sort orders the domains by name
+func (s *Summary) sort() {
+	sort.Slice(s.Domains, func(i, j int) bool {
+		return s.Domains[i].Domain < s.Domains[j].Domain
+	})
+	s.byDomain = nil
+}
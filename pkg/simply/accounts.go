@@ -0,0 +1,179 @@
+package simply
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// API is the part of the Simply.com API used to serve ExternalDNS, provided
+// by a single Client or by Accounts spanning several accounts
+type API interface {
+	ListDomains() ([]string, error)
+	ListRecords(domain string) ([]Record, error)
+	Apply(m Mutation) error
+	Status() Status
+	// Ping checks that Simply.com is reachable and accepts the credentials,
+	// without any other effect
+	Ping() error
+}
+
+// Account is a named Simply.com account
+type Account struct {
+	Name   string
+	Client *Client
+}
+
+// Accounts serves domains from several Simply.com accounts, routing every
+// request to the client of the account that owns the zone. Zone ownership is
+// learned from ListDomains.
+type Accounts struct {
+	Logger *slog.Logger
+
+	accounts []Account
+	mu       sync.RWMutex
+	zones    map[string]Account
+}
+
+// NewAccounts creates a router over the given accounts. When a domain is
+// found in more than one account, the first account listed owns it.
+func NewAccounts(logger *slog.Logger, accounts ...Account) *Accounts {
+	return &Accounts{
+		Logger:   logger,
+		accounts: accounts,
+		zones:    make(map[string]Account),
+	}
+}
+
+// Accounts returns the configured accounts
+func (a *Accounts) Accounts() []Account {
+	return a.accounts
+}
+
+// ListDomains lists the domains of every account and records which account
+// owns each one. It fails if any account cannot be listed, so a partial list
+// never replaces a complete one.
+func (a *Accounts) ListDomains() ([]string, error) {
+	zones := make(map[string]Account)
+	var domains []string
+	var errs []error
+	for _, account := range a.accounts {
+		found, err := account.Client.ListDomains()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("account %s: %w", account.Name, err))
+			continue
+		}
+		for _, domain := range found {
+			if owner, ok := zones[domain]; ok {
+				a.Logger.Warn("Domain found in more than one Simply.com account, using the first",
+					"domain", domain,
+					"account", owner.Name,
+					"ignoredAccount", account.Name,
+				)
+				continue
+			}
+			zones[domain] = account
+			domains = append(domains, domain)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	a.zones = zones
+	a.mu.Unlock()
+
+	sort.Strings(domains)
+	return domains, nil
+}
+
+// AccountOf returns the name of the account owning domain
+func (a *Accounts) AccountOf(domain string) (string, bool) {
+	account, err := a.account(domain)
+	if err != nil {
+		return "", false
+	}
+	return account.Name, true
+}
+
+// account returns the account owning the zone of domain: the longest
+// discovered zone that is domain itself or one of its parents, so zones
+// under multi-label suffixes such as co.uk are routed correctly
+func (a *Accounts) account(domain string) (Account, error) {
+	name := strings.ToLower(strings.TrimSuffix(domain, "."))
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	zone := ""
+	for z := range a.zones {
+		if len(z) > len(zone) && (name == z || strings.HasSuffix(name, "."+z)) {
+			zone = z
+		}
+	}
+	if zone == "" {
+		return Account{}, fmt.Errorf("no Simply.com account manages domain %s", domain)
+	}
+	return a.zones[zone], nil
+}
+
+// ListRecords lists the records of domain in the account owning it
+func (a *Accounts) ListRecords(domain string) ([]Record, error) {
+	account, err := a.account(domain)
+	if err != nil {
+		return nil, err
+	}
+	return account.Client.ListRecords(domain)
+}
+
+// Apply sends a mutation to the account owning its domain
+func (a *Accounts) Apply(m Mutation) error {
+	account, err := a.account(m.Domain)
+	if err != nil {
+		return err
+	}
+	return account.Client.Apply(m)
+}
+
+// Ping checks every account. Unlike ListDomains it leaves the zone routing
+// untouched, so health probes cannot change which account serves a domain.
+func (a *Accounts) Ping() error {
+	var errs []error
+	for _, account := range a.accounts {
+		if err := account.Client.Ping(); err != nil {
+			errs = append(errs, fmt.Errorf("account %s: %w", account.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Status combines the status of all accounts: it only reports a recent
+// success if every account succeeded since, and reports the latest failure
+// of any account
+func (a *Accounts) Status() Status {
+	var combined Status
+	for i, account := range a.accounts {
+		status := account.Client.Status()
+		if i == 0 || status.LastSuccess.Before(combined.LastSuccess) {
+			combined.LastSuccess = status.LastSuccess
+		}
+		if status.LastFailure.After(combined.LastFailure) {
+			combined.LastFailure = status.LastFailure
+			combined.LastError = fmt.Sprintf("account %s: %s", account.Name, status.LastError)
+		}
+		combined.AuthFailed = combined.AuthFailed || status.AuthFailed
+	}
+	return combined
+}
+
+// Statuses returns the status of each account by name
+func (a *Accounts) Statuses() map[string]Status {
+	statuses := make(map[string]Status, len(a.accounts))
+	for _, account := range a.accounts {
+		statuses[account.Name] = account.Client.Status()
+	}
+	return statuses
+}
@@ -0,0 +1,133 @@
+package simply
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeServer serves the Simply.com API for one account owning domains and
+// records the requests it receives
+type fakeServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []string
+}
+
+func newFakeServer(t *testing.T, domains ...string) *fakeServer {
+	s := &fakeServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+		s.mu.Unlock()
+
+		if r.URL.Path == "/my/products" {
+			var products []string
+			for _, d := range domains {
+				products = append(products, fmt.Sprintf(`{"object":%q,"domain":{"name":%q,"managed":true}}`, d, d))
+			}
+			fmt.Fprintf(w, `{"products":[%s]}`, strings.Join(products, ","))
+			return
+		}
+		fmt.Fprint(w, `{"status":200,"records":[]}`)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *fakeServer) client() *Client {
+	c := NewClient("S1", "key")
+	c.BaseURL = s.URL + "/"
+	return c
+}
+
+func (s *fakeServer) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.requests...)
+}
+
+func TestAccountsRouting(t *testing.T) {
+	uk := newFakeServer(t, "example.co.uk")
+	com := newFakeServer(t, "example.com", "shop.example.com")
+	accounts := NewAccounts(slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Account{Name: "uk", Client: uk.client()},
+		Account{Name: "com", Client: com.client()},
+	)
+
+	domains, err := accounts.ListDomains()
+	if err != nil {
+		t.Fatalf("ListDomains() error = %v", err)
+	}
+	if want := "example.co.uk,example.com,shop.example.com"; strings.Join(domains, ",") != want {
+		t.Errorf("ListDomains() = %v, want %s", domains, want)
+	}
+
+	tests := []struct {
+		domain string
+		want   string
+	}{
+		{"example.co.uk", "uk"},
+		{"www.example.co.uk", "uk"},
+		{"Example.COM.", "com"},
+		{"api.shop.example.com", "com"},
+	}
+	for _, tt := range tests {
+		if got, ok := accounts.AccountOf(tt.domain); !ok || got != tt.want {
+			t.Errorf("AccountOf(%q) = %q, %v, want %q", tt.domain, got, ok, tt.want)
+		}
+	}
+	for _, domain := range []string{"co.uk", "other.co.uk", "example.org"} {
+		if got, ok := accounts.AccountOf(domain); ok {
+			t.Errorf("AccountOf(%q) = %q, want no account", domain, got)
+		}
+	}
+
+	if _, err := accounts.ListRecords("example.co.uk"); err != nil {
+		t.Fatalf("ListRecords() error = %v", err)
+	}
+	m := Mutation{Action: ActionCreate, Domain: "example.co.uk", Record: Record{Name: "www.example.co.uk", Type: "A", Data: "192.0.2.1", TTL: 3600}}
+	if err := accounts.Apply(m); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if err := accounts.Apply(Mutation{Action: ActionCreate, Domain: "example.org"}); err == nil {
+		t.Error("Apply() to an unknown domain succeeded")
+	}
+
+	wantUK := []string{
+		"GET /my/products",
+		"GET /my/products/example.co.uk/dns/records",
+		"POST /my/products/example.co.uk/dns/records",
+	}
+	if got := uk.received(); strings.Join(got, ",") != strings.Join(wantUK, ",") {
+		t.Errorf("requests to the uk account = %v, want %v", got, wantUK)
+	}
+	if got := com.received(); len(got) != 1 {
+		t.Errorf("requests to the com account = %v, want only the domain listing", got)
+	}
+}
+
+func TestAccountsFirstOwnerWins(t *testing.T) {
+	first := newFakeServer(t, "example.com")
+	second := newFakeServer(t, "example.com", "example.org")
+	accounts := NewAccounts(slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Account{Name: "first", Client: first.client()},
+		Account{Name: "second", Client: second.client()},
+	)
+
+	domains, err := accounts.ListDomains()
+	if err != nil {
+		t.Fatalf("ListDomains() error = %v", err)
+	}
+	if want := "example.com,example.org"; strings.Join(domains, ",") != want {
+		t.Errorf("ListDomains() = %v, want %s", domains, want)
+	}
+	if got, _ := accounts.AccountOf("example.com"); got != "first" {
+		t.Errorf("AccountOf(example.com) = %q, want first", got)
+	}
+}
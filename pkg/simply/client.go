@@ -4,30 +4,68 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 )
 
 const (
 	BaseURL        = "https://api.simply.com/2/"
 	DefaultTimeout = 30 * time.Second
+
+	// MinTTL is the lowest record TTL Simply.com accepts, in seconds
+	MinTTL = 60
 )
 
 // Client is a Simply.com API client
 type Client struct {
-	AccountName string
-	APIKey      string
-	BaseURL     string
-	HTTPClient  *http.Client
+	BaseURL    string
+	HTTPClient *http.Client
+
+	mu          sync.Mutex
+	accountName string
+	apiKey      string
+	status      Status
+}
+
+// Status describes the outcome of the most recent Simply.com API requests
+type Status struct {
+	LastSuccess time.Time `json:"lastSuccess,omitempty"`
+	LastFailure time.Time `json:"lastFailure,omitempty"`
+	LastError   string    `json:"lastError,omitempty"`
+	// AuthFailed is set when the most recent request was rejected because of
+	// the credentials, until a request succeeds
+	AuthFailed bool `json:"authFailed,omitempty"`
+}
+
+// APIError is returned when Simply.com answers with a non-2xx status code
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// IsAuthError reports whether err was caused by Simply.com rejecting the credentials
+func IsAuthError(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden
+	}
+	return false
 }
 
 // NewClient creates a new Simply.com API client
 func NewClient(accountName, apiKey string) *Client {
 	return &Client{
-		AccountName: accountName,
-		APIKey:      apiKey,
+		accountName: accountName,
+		apiKey:      apiKey,
 		BaseURL:     BaseURL,
 		HTTPClient: &http.Client{
 			Timeout: DefaultTimeout,
@@ -37,16 +75,70 @@ func NewClient(accountName, apiKey string) *Client {
 
 // Record represents a DNS record in Simply.com
 type Record struct {
-	ID      int    `json:"record_id,omitempty"`
-	Type    string `json:"type"`
-	Name    string `json:"name"`
-	Data    string `json:"data"`
-	TTL     int    `json:"ttl"`
-	Comment string `json:"comment,omitempty"`
+	ID       int    `json:"record_id,omitempty"`
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	Data     string `json:"data"`
+	TTL      int    `json:"ttl"`
+	Priority int    `json:"priority,omitempty"` // MX and SRV only
+	Comment  string `json:"comment,omitempty"`
+}
+
+// AccountName returns the Simply.com account the client authenticates as
+func (c *Client) AccountName() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.accountName
+}
+
+// SetCredentials replaces the account name and API key. Requests already in
+// flight finish with the previous credentials.
+func (c *Client) SetCredentials(accountName, apiKey string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.accountName = accountName
+	c.apiKey = apiKey
+}
+
+// credentials returns the current account name and API key
+func (c *Client) credentials() (string, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.accountName, c.apiKey
+}
+
+// Status returns the outcome of the most recent API requests
+func (c *Client) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
+
+// recordResult updates the client status after an API request
+func (c *Client) recordResult(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.status.LastFailure = time.Now()
+		c.status.LastError = err.Error()
+		if IsAuthError(err) {
+			c.status.AuthFailed = true
+		}
+		return
+	}
+	c.status.LastSuccess = time.Now()
+	c.status.AuthFailed = false
 }
 
-// makeRequest performs an HTTP request with authentication
+// makeRequest performs an HTTP request with authentication and records its outcome
 func (c *Client) makeRequest(method, endpoint string, body interface{}) ([]byte, error) {
+	respBody, err := c.doRequest(method, endpoint, body)
+	c.recordResult(err)
+	return respBody, err
+}
+
+// doRequest performs an HTTP request with authentication
+func (c *Client) doRequest(method, endpoint string, body interface{}) ([]byte, error) {
 	var reqBody io.Reader
 	if body != nil {
 		jsonBody, err := json.Marshal(body)
@@ -63,7 +155,8 @@ func (c *Client) makeRequest(method, endpoint string, body interface{}) ([]byte,
 	}
 
 	// Add Basic Authentication
-	auth := base64.StdEncoding.EncodeToString([]byte(c.AccountName + ":" + c.APIKey))
+	accountName, apiKey := c.credentials()
+	auth := base64.StdEncoding.EncodeToString([]byte(accountName + ":" + apiKey))
 	req.Header.Set("Authorization", "Basic "+auth)
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Accept", "application/json")
@@ -80,12 +173,19 @@ func (c *Client) makeRequest(method, endpoint string, body interface{}) ([]byte,
 	}
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(respBody))
+		return nil, &APIError{StatusCode: resp.StatusCode, Body: string(respBody)}
 	}
 
 	return respBody, nil
 }
 
+// Ping checks that Simply.com is reachable and accepts the credentials by
+// listing the domains of the account
+func (c *Client) Ping() error {
+	_, err := c.ListDomains()
+	return err
+}
+
 // ListDomains returns all domains managed by Simply.com
 func (c *Client) ListDomains() ([]string, error) {
 	resp, err := c.makeRequest("GET", "my/products", nil)
@@ -136,6 +236,8 @@ func (c *Client) ListRecords(domain string) ([]Record, error) {
 			TTL      int    `json:"ttl"`
 			Data     string `json:"data"`
 			Type     string `json:"type"`
+			Priority int    `json:"priority"`
+			Comment  string `json:"comment"`
 		} `json:"records"`
 	}
 
@@ -146,17 +248,25 @@ func (c *Client) ListRecords(domain string) ([]Record, error) {
 	var records []Record
 	for _, r := range response.Records {
 		records = append(records, Record{
-			ID:   r.RecordID,
-			Type: r.Type,
-			Name: r.Name,
-			Data: r.Data,
-			TTL:  r.TTL,
+			ID:       r.RecordID,
+			Type:     r.Type,
+			Name:     r.Name,
+			Data:     r.Data,
+			TTL:      r.TTL,
+			Priority: r.Priority,
+			Comment:  r.Comment,
 		})
 	}
 
 	return records, nil
 }
 
+// HasPriority reports whether the record type carries a priority. It is
+// sent even when zero, which is valid, e.g. for a null MX.
+func (r Record) HasPriority() bool {
+	return strings.EqualFold(r.Type, "MX") || strings.EqualFold(r.Type, "SRV")
+}
+
 // AddRecord adds a new DNS record
 func (c *Client) AddRecord(domain string, record Record) error {
 	endpoint := fmt.Sprintf("my/products/%s/dns/records", domain)
@@ -168,6 +278,9 @@ func (c *Client) AddRecord(domain string, record Record) error {
 		"ttl":     record.TTL,
 		"comment": record.Comment,
 	}
+	if record.HasPriority() {
+		payload["priority"] = record.Priority
+	}
 
 	_, err := c.makeRequest("POST", endpoint, payload)
 	if err != nil {
@@ -188,6 +301,9 @@ func (c *Client) UpdateRecord(domain string, record Record) error {
 		"ttl":     record.TTL,
 		"comment": record.Comment,
 	}
+	if record.HasPriority() {
+		payload["priority"] = record.Priority
+	}
 
 	_, err := c.makeRequest("PUT", endpoint, payload)
 	if err != nil {
@@ -0,0 +1,43 @@
+package simply
+
+import "fmt"
+
+// Mutation actions
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// Mutation is a single change to a Simply.com zone
+type Mutation struct {
+	Action string `json:"action"`
+	Domain string `json:"domain"`
+	// Record is the record to create, the updated record, or the record to delete
+	Record Record `json:"record"`
+	// Before is the record as it was before an update or delete, if known
+	Before *Record `json:"before,omitempty"`
+}
+
+func (m Mutation) String() string {
+	switch m.Action {
+	case ActionCreate:
+		return fmt.Sprintf("create %s %s %s in %s", m.Record.Type, m.Record.Name, m.Record.Data, m.Domain)
+	default:
+		return fmt.Sprintf("%s %s %s (id %d) in %s", m.Action, m.Record.Type, m.Record.Name, m.Record.ID, m.Domain)
+	}
+}
+
+// Apply sends a mutation to Simply.com
+func (c *Client) Apply(m Mutation) error {
+	switch m.Action {
+	case ActionCreate:
+		return c.AddRecord(m.Domain, m.Record)
+	case ActionUpdate:
+		return c.UpdateRecord(m.Domain, m.Record)
+	case ActionDelete:
+		return c.DeleteRecord(m.Domain, m.Record)
+	default:
+		return fmt.Errorf("unknown mutation action %q", m.Action)
+	}
+}
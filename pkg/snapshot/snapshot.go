@@ -0,0 +1,96 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
+)
+
+// FormatVersion is the version of the snapshot file format written by Save
+const FormatVersion = 1
+
+// Snapshot is a point-in-time copy of the records of one or more zones
+type Snapshot struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	Account string    `json:"account"`
+	Zones   []Zone    `json:"zones"`
+}
+
+// Zone holds the records of a single domain
+type Zone struct {
+	Domain  string          `json:"domain"`
+	Records []simply.Record `json:"records"`
+}
+
+// Take snapshots the records of the given domains
+func Take(client *simply.Client, domains []string) (*Snapshot, error) {
+	snap := &Snapshot{
+		Version: FormatVersion,
+		Created: time.Now().UTC(),
+		Account: client.AccountName(),
+	}
+
+	sorted := append([]string{}, domains...)
+	sort.Strings(sorted)
+
+	for _, domain := range sorted {
+		records, err := client.ListRecords(domain)
+		if err != nil {
+			return nil, fmt.Errorf("failed to snapshot domain %s: %w", domain, err)
+		}
+		snap.Zones = append(snap.Zones, Zone{Domain: domain, Records: records})
+	}
+	return snap, nil
+}
+
+// Zone returns the zone for domain, if the snapshot contains it
+func (s *Snapshot) Zone(domain string) (Zone, bool) {
+	for _, z := range s.Zones {
+		if z.Domain == domain {
+			return z, true
+		}
+	}
+	return Zone{}, false
+}
+
+// Save writes the snapshot to path as indented JSON. The file is written
+// next to its destination and renamed into place, so an interrupted save
+// never leaves a truncated backup behind.
+func (s *Snapshot) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return nil
+}
+
+// Load reads a snapshot from path, rejecting unknown format versions
+func Load(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot: %w", err)
+	}
+	if snap.Version < 1 || snap.Version > FormatVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d (supported: 1-%d)", snap.Version, FormatVersion)
+	}
+	return &snap, nil
+}
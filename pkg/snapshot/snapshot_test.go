@@ -0,0 +1,213 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/zone"
+)
+
+// fakeSimply is an in-memory Simply.com DNS API
+type fakeSimply struct {
+	mu     sync.Mutex
+	zones  map[string][]simply.Record
+	nextID int
+}
+
+func (f *fakeSimply) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// my/products/{domain}/dns/records[/{id}]
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 5 {
+		http.NotFound(w, r)
+		return
+	}
+	domain := parts[2]
+	records, ok := f.zones[domain]
+	if !ok {
+		http.Error(w, `{"message":"domain not found"}`, http.StatusNotFound)
+		return
+	}
+	var id int
+	if len(parts) == 6 {
+		id, _ = strconv.Atoi(parts[5])
+	}
+
+	var body simply.Record
+	if r.Method == http.MethodPost || r.Method == http.MethodPut {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": 200, "records": records})
+		return
+	case http.MethodPost:
+		f.nextID++
+		body.ID = f.nextID
+		records = append(records, body)
+	case http.MethodPut, http.MethodDelete:
+		i := 0
+		for i < len(records) && records[i].ID != id {
+			i++
+		}
+		if i == len(records) {
+			http.Error(w, `{"message":"record not found"}`, http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodPut {
+			body.ID = id
+			records[i] = body
+		} else {
+			records = append(records[:i], records[i+1:]...)
+		}
+	}
+	f.zones[domain] = records
+	fmt.Fprint(w, `{"status":200}`)
+}
+
+func newFakeSimply(t *testing.T, zones map[string][]simply.Record) (*fakeSimply, *simply.Client) {
+	t.Helper()
+	f := &fakeSimply{zones: zones, nextID: 100}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	client := simply.NewClient("S123456", "key")
+	client.BaseURL = server.URL + "/"
+	return f, client
+}
+
+func testZones() map[string][]simply.Record {
+	return map[string][]simply.Record{
+		"example.com": {
+			{ID: 1, Name: "@", Type: "A", Data: "192.0.2.1", TTL: 3600},
+			{ID: 2, Name: "@", Type: "MX", Data: "mail.example.com", Priority: 10, TTL: 3600},
+			{ID: 3, Name: "www", Type: "CNAME", Data: "example.com", TTL: 300},
+		},
+		"example.org": {
+			{ID: 4, Name: "@", Type: "TXT", Data: `"v=spf1 -all"`, TTL: 3600},
+		},
+	}
+}
+
+func TestTakeSaveLoad(t *testing.T) {
+	_, client := newFakeSimply(t, testZones())
+
+	snap, err := Take(client, []string{"example.org", "example.com"})
+	if err != nil {
+		t.Fatalf("Take() error = %v", err)
+	}
+	if snap.Account != "S123456" || snap.Version != FormatVersion {
+		t.Errorf("Take() = account %q version %d", snap.Account, snap.Version)
+	}
+	if len(snap.Zones) != 2 || snap.Zones[0].Domain != "example.com" {
+		t.Fatalf("Zones = %+v, want example.com and example.org in order", snap.Zones)
+	}
+
+	path := filepath.Join(t.TempDir(), "backup.json")
+	if err := snap.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !loaded.Created.Equal(snap.Created) {
+		t.Errorf("Created = %v, want %v", loaded.Created, snap.Created)
+	}
+	loaded.Created = snap.Created
+	if !reflect.DeepEqual(loaded, snap) {
+		t.Errorf("Load() =\n%+v\nwant\n%+v", loaded, snap)
+	}
+	if z, ok := loaded.Zone("example.org"); !ok || z.Records[0].Data != `"v=spf1 -all"` {
+		t.Errorf("Zone(example.org) = %+v, %v", z, ok)
+	}
+	if _, ok := loaded.Zone("example.net"); ok {
+		t.Error("Zone() found a domain not in the snapshot")
+	}
+}
+
+func TestTakeFailsOnMissingDomain(t *testing.T) {
+	_, client := newFakeSimply(t, testZones())
+	if _, err := Take(client, []string{"example.com", "example.net"}); err == nil {
+		t.Error("Take() of a missing domain succeeded")
+	}
+}
+
+func TestLoadRejectsUnknownVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backup.json")
+	for _, data := range []string{`{"version":0}`, `{"version":99}`, `not json`} {
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path); err == nil {
+			t.Errorf("Load(%s) succeeded", data)
+		}
+	}
+}
+
+// TestRestore restores a zone changed after the snapshot, the way the
+// restore command does
+func TestRestore(t *testing.T) {
+	fake, client := newFakeSimply(t, testZones())
+	snap, err := Take(client, []string{"example.com"})
+	if err != nil {
+		t.Fatalf("Take() error = %v", err)
+	}
+
+	// Out-of-band changes: the apex A record edited, the MX deleted, a
+	// record added and www turned into an A record
+	fake.mu.Lock()
+	fake.zones["example.com"] = []simply.Record{
+		{ID: 1, Name: "@", Type: "A", Data: "192.0.2.99", TTL: 3600},
+		{ID: 5, Name: "www", Type: "A", Data: "192.0.2.5", TTL: 300},
+		{ID: 6, Name: "stray", Type: "A", Data: "192.0.2.6", TTL: 300},
+	}
+	fake.mu.Unlock()
+
+	z, _ := snap.Zone("example.com")
+	current, err := client.ListRecords("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := zone.Diff("example.com", current, z.Records, zone.Options{})
+	if applied, err := zone.Apply(client, plan, nil); err != nil || applied != len(plan) {
+		t.Fatalf("zone.Apply() = %d, %v, want %d applied", applied, err, len(plan))
+	}
+
+	restored, err := client.ListRecords("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := describe(restored), describe(z.Records); !reflect.DeepEqual(got, want) {
+		t.Errorf("restored zone = %v, want %v", got, want)
+	}
+	if again := zone.Diff("example.com", restored, z.Records, zone.Options{}); len(again) != 0 {
+		t.Errorf("restore left changes to make: %+v", again)
+	}
+}
+
+// describe returns records without their IDs, sorted
+func describe(records []simply.Record) []string {
+	var out []string
+	for _, r := range records {
+		out = append(out, fmt.Sprintf("%s %s %d %s %d", r.Name, r.Type, r.Priority, r.Data, r.TTL))
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,188 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
+)
+
+// planChanges resolves a batch into the Simply.com mutations to apply, in
+// the order creates, updates, deletes. recordMap holds the current records by
+// recordKey. Updates without actual changes and deletes of records that no
+// longer exist are dropped.
+func (h *Handler) planChanges(p *Policy, changes *Changes, recordMap map[string][]simply.Record) ([]simply.Mutation, error) {
+	var plan []simply.Mutation
+
+	for _, ep := range changes.Create {
+		mutations, err := h.createMutations(p, ep)
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, mutations...)
+	}
+
+	for i, newEp := range changes.UpdateNew {
+		oldEp := changes.UpdateOld[i]
+
+		// Lookup the records of the endpoint
+		key := recordKey(oldEp.DNSName, oldEp.RecordType)
+		existing, found := recordMap[key]
+		if !found {
+			h.Logger.Error("Record not found in map for update", "key", key)
+			return nil, fmt.Errorf("record not found: %s", key)
+		}
+
+		mutations, err := h.updateMutations(p, newEp, existing)
+		if err != nil {
+			return nil, err
+		}
+		if len(mutations) == 0 {
+			h.Logger.Info("Skipping update - no actual changes detected", "dnsName", newEp.DNSName, "recordType", newEp.RecordType)
+			continue
+		}
+		plan = append(plan, mutations...)
+	}
+
+	for _, ep := range changes.Delete {
+		key := recordKey(ep.DNSName, ep.RecordType)
+		existing, found := recordMap[key]
+		if !found {
+			h.Logger.Warn("Record not found in map for deletion, skipping", "key", key)
+			continue
+		}
+
+		// Delete only the records of the targets ExternalDNS knows about
+		targets := make(map[string]bool, len(ep.Targets))
+		for _, target := range ep.Targets {
+			targets[target] = true
+		}
+		for _, record := range existing {
+			if !targets[recordTarget(record)] {
+				continue
+			}
+			mutation, err := h.deleteMutation(ep, record)
+			if err != nil {
+				return nil, err
+			}
+			plan = append(plan, mutation)
+		}
+	}
+
+	return plan, nil
+}
+
+// recordKey identifies the records of one endpoint in a zone
+func recordKey(dnsName, recordType string) string {
+	return fmt.Sprintf("%s:%s", canonicalName(dnsName), strings.ToUpper(recordType))
+}
+
+// applyMutation sends a single planned mutation to Simply.com
+func (h *Handler) applyMutation(m simply.Mutation) error {
+	record := m.Record
+	switch m.Action {
+	case simply.ActionCreate:
+		h.Logger.Info("Creating Simply.com record", "domain", m.Domain, "name", record.Name, "type", record.Type, "data", record.Data, "ttl", record.TTL)
+	case simply.ActionUpdate:
+		h.Logger.Info("Updating Simply.com record", "id", record.ID, "domain", m.Domain, "name", record.Name, "type", record.Type, "data", record.Data, "ttl", record.TTL)
+	case simply.ActionDelete:
+		h.Logger.Info("Deleting Simply.com record", "id", record.ID, "domain", m.Domain, "name", record.Name, "type", record.Type)
+	}
+
+	if err := h.Client.Apply(m); err != nil {
+		return fmt.Errorf("failed to %s record: %w", m.Action, err)
+	}
+	return nil
+}
+
+// batch tracks the progress of an ApplyChanges request
+type batch struct {
+	id      string
+	started time.Time
+	plan    []simply.Mutation
+
+	mu        sync.Mutex
+	completed int
+}
+
+// BatchStatus summarizes an in-flight ApplyChanges batch
+type BatchStatus struct {
+	ID        string    `json:"id"`
+	Started   time.Time `json:"started"`
+	Completed int       `json:"completed"`
+	Total     int       `json:"total"`
+	Remaining []string  `json:"remaining,omitempty"`
+}
+
+// newBatchID returns a random identifier used to correlate a batch in logs
+func newBatchID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+func (b *batch) complete() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.completed++
+}
+
+func (b *batch) status() BatchStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BatchStatus{
+		ID:        b.id,
+		Started:   b.started,
+		Completed: b.completed,
+		Total:     len(b.plan),
+	}
+	for _, c := range b.plan[b.completed:] {
+		status.Remaining = append(status.Remaining, c.String())
+	}
+	return status
+}
+
+// startBatch registers a batch as in flight
+func (h *Handler) startBatch(id string, plan []simply.Mutation) *batch {
+	b := &batch{id: id, started: time.Now(), plan: plan}
+
+	h.batchMu.Lock()
+	defer h.batchMu.Unlock()
+	if h.inflight == nil {
+		h.inflight = make(map[string]*batch)
+	}
+	h.inflight[id] = b
+	return b
+}
+
+// finishBatch removes a batch from the in-flight set
+func (h *Handler) finishBatch(b *batch) {
+	h.batchMu.Lock()
+	defer h.batchMu.Unlock()
+	delete(h.inflight, b.id)
+}
+
+// InFlight returns the status of every ApplyChanges batch still running
+func (h *Handler) InFlight() []BatchStatus {
+	h.batchMu.Lock()
+	defer h.batchMu.Unlock()
+
+	var statuses []BatchStatus
+	for _, b := range h.inflight {
+		statuses = append(statuses, b.status())
+	}
+	return statuses
+}
+
+// BeginShutdown makes ApplyChanges refuse new batches; batches already
+// running are allowed to finish
+func (h *Handler) BeginShutdown() {
+	h.shuttingDown.Store(true)
+}
@@ -1,12 +1,20 @@
 package webhook
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"strings"
-
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/audit"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/drift"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/journal"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/notify"
 	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
 	"sigs.k8s.io/external-dns/endpoint"
 )
@@ -15,30 +23,141 @@ const (
 	MediaTypeVersion = "application/external.dns.webhook+json;version=1"
 	DefaultComment   = "Managed by External-DNS"
 	DefaultTTL       = 3600 // 1 hour
+
+	// PartialResultHeader is set on GetRecords responses that are missing domains
+	PartialResultHeader = "X-Simply-Partial-Result"
+	// FailedDomainsHeader lists the domains missing from a partial GetRecords response
+	FailedDomainsHeader = "X-Simply-Failed-Domains"
+)
+
+// FailurePolicy controls how GetRecords behaves when listing a domain fails
+type FailurePolicy string
+
+const (
+	// FailurePolicyFail fails the whole request if any domain cannot be listed
+	FailurePolicyFail FailurePolicy = "fail"
+	// FailurePolicyPartial returns the records of the remaining domains and
+	// marks the response as partial via PartialResultHeader
+	FailurePolicyPartial FailurePolicy = "partial"
 )
 
+// ParseFailurePolicy parses a failure policy name, defaulting to FailurePolicyFail
+func ParseFailurePolicy(s string) (FailurePolicy, error) {
+	switch FailurePolicy(strings.ToLower(strings.TrimSpace(s))) {
+	case "", FailurePolicyFail:
+		return FailurePolicyFail, nil
+	case FailurePolicyPartial:
+		return FailurePolicyPartial, nil
+	default:
+		return "", fmt.Errorf("invalid failure policy %q (expected %q or %q)", s, FailurePolicyFail, FailurePolicyPartial)
+	}
+}
+
 // Handler handles webhook requests from ExternalDNS
 type Handler struct {
-	Client       *simply.Client
-	Logger       *slog.Logger
-	DomainFilter []string
+	// Client is a single Simply.com account, or several accounts routed by zone
+	Client simply.API
+	Logger *slog.Logger
+
+	// policy holds the settings that can be reloaded, see SetPolicy
+	policy atomic.Pointer[Policy]
+
+	// ZoneLockTimeout bounds how long ApplyChanges waits for another batch
+	// touching the same zones to finish
+	ZoneLockTimeout time.Duration
+	zoneLocks       zoneLocks
+
+	// Journal, when set, records every batch on disk before it is applied
+	Journal *journal.Journal
+
+	// Drift, when set, remembers applied records for drift detection
+	Drift *drift.Tracker
+
+	// Audit, when set, receives an event for every mutation sent to Simply.com
+	Audit audit.Sink
+
+	// Notifier, when set, is sent a summary of every applied batch
+	Notifier *notify.Notifier
+
+	// HealthCacheTTL is how long readiness checks against Simply.com are cached
+	HealthCacheTTL time.Duration
+	upstream       upstreamCheck
+
+	mu           sync.RWMutex
+	domainFilter []string
+	discovered   bool
+
+	batchMu      sync.Mutex
+	inflight     map[string]*batch
+	shuttingDown atomic.Bool
+}
+
+// Changes is the set of endpoint changes sent by ExternalDNS to ApplyChanges
+type Changes struct {
+	Create    []*endpoint.Endpoint `json:"create"`
+	UpdateOld []*endpoint.Endpoint `json:"updateOld"`
+	UpdateNew []*endpoint.Endpoint `json:"updateNew"`
+	Delete    []*endpoint.Endpoint `json:"delete"`
 }
 
 // NewHandler creates a new webhook handler
-func NewHandler(client *simply.Client, logger *slog.Logger, domainFilter []string) *Handler {
-	return &Handler{
-		Client:       client,
-		Logger:       logger,
-		DomainFilter: domainFilter,
+func NewHandler(client simply.API, logger *slog.Logger, domainFilter []string) *Handler {
+	h := &Handler{
+		Client:          client,
+		Logger:          logger,
+		HealthCacheTTL:  DefaultHealthCacheTTL,
+		ZoneLockTimeout: DefaultZoneLockTimeout,
+		domainFilter:    domainFilter,
+		discovered:      domainFilter != nil,
+	}
+	h.SetPolicy(DefaultPolicy())
+	return h
+}
+
+// Domains returns the domains currently managed by the handler
+func (h *Handler) Domains() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.domainFilter
+}
+
+// SetDomains atomically replaces the managed domains and marks domain
+// discovery as complete. Requests already in flight keep using the list they
+// started with.
+func (h *Handler) SetDomains(domains []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.domainFilter = domains
+	h.discovered = true
+}
+
+// Ready reports whether domain discovery has completed, so records can be served
+func (h *Handler) Ready() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.discovered
+}
+
+// requireReady replies 503 and returns false while domain discovery is pending.
+// ExternalDNS retries server errors, so it simply waits for discovery.
+func (h *Handler) requireReady(w http.ResponseWriter) bool {
+	if h.Ready() {
+		return true
 	}
+	w.Header().Set("Retry-After", "5")
+	http.Error(w, "Domain discovery in progress", http.StatusServiceUnavailable)
+	return false
 }
 
 func (h *Handler) Negotiate(w http.ResponseWriter, r *http.Request) {
-	// Respond with the supported media type version
-	response := map[string]interface{}{
-		"domainFilter": h.DomainFilter,
+	if !h.requireReady(w) {
+		return
 	}
 
+	// Respond with the domain filter in ExternalDNS's serialized format, so
+	// ExternalDNS only plans changes we can apply
+	response := h.Policy().Filter.EndpointFilter(h.Domains())
+
 	jsonData, err := json.Marshal(response)
 	if err != nil {
 		h.Logger.Error("Failed to marshal negotiation response", "error", err)
@@ -54,6 +173,9 @@ func (h *Handler) Negotiate(w http.ResponseWriter, r *http.Request) {
 
 // GetRecords returns all current DNS records
 func (h *Handler) GetRecords(w http.ResponseWriter, r *http.Request) {
+	if !h.requireReady(w) {
+		return
+	}
 
 	type endpointResponse struct {
 		DNSName    string   `json:"dnsName"`
@@ -63,19 +185,29 @@ func (h *Handler) GetRecords(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var response []endpointResponse
+	var failedDomains []string
+	domains := h.Domains()
+	policy := h.Policy()
 
 	// Get records for each configured domain
-	for _, domain := range h.DomainFilter {
+	for _, domain := range domains {
 
 		records, err := h.Client.ListRecords(domain)
 		if err != nil {
-			h.Logger.Error("Failed to list records for domain", "domain", domain, "error", err)
+			// A missing domain must never look like an empty zone, otherwise
+			// ExternalDNS will try to recreate every record in it
+			h.Logger.Error("Failed to list records for domain", "domain", domain, "policy", policy.GetRecordsPolicy, "error", err)
+			listRecordsErrors.Inc(domain)
+			failedDomains = append(failedDomains, domain)
 			continue
 		}
 
 		h.Logger.Debug("Found records for domain", "count", len(records), "domain", domain)
 
-		// Convert Simply records to External-DNS endpoints
+		// Convert Simply records to External-DNS endpoints, grouping the
+		// records of one name and type into an endpoint with several targets
+		grouped := make(map[string]*endpoint.Endpoint)
+		var endpoints []*endpoint.Endpoint
 		for _, record := range records {
 			h.Logger.Debug("Processing record", "id", record.ID, "type", record.Type, "name", record.Name, "data", record.Data)
 
@@ -87,17 +219,44 @@ func (h *Handler) GetRecords(w http.ResponseWriter, r *http.Request) {
 				dnsName = record.Name + "." + domain
 			}
 
-			ep := endpointResponse{
-				DNSName:    dnsName,
-				RecordType: record.Type,
-				Targets:    []string{record.Data},
-				RecordTTL:  record.TTL,
+			if policy.HideProtected && policy.Protected.Match(domain, dnsName, record.Type) {
+				h.Logger.Debug("Hiding protected record", "id", record.ID, "type", record.Type, "name", dnsName)
+				continue
+			}
+
+			key := recordKey(dnsName, record.Type)
+			ep, found := grouped[key]
+			if !found {
+				ep = &endpoint.Endpoint{DNSName: dnsName, RecordType: record.Type, RecordTTL: endpoint.TTL(record.TTL)}
+				grouped[key] = ep
+				endpoints = append(endpoints, ep)
+			} else if endpoint.TTL(record.TTL) < ep.RecordTTL {
+				// An endpoint has a single TTL; report the lowest when the
+				// records disagree
+				ep.RecordTTL = endpoint.TTL(record.TTL)
 			}
-			response = append(response, ep)
+			ep.Targets = append(ep.Targets, recordTarget(record))
 		}
+
+		for _, ep := range endpoints {
+			h.normalizeEndpoint(policy, ep)
+			response = append(response, endpointResponse{
+				DNSName:    ep.DNSName,
+				RecordType: ep.RecordType,
+				Targets:    ep.Targets,
+				RecordTTL:  int(ep.RecordTTL),
+			})
+		}
+	}
+
+	if len(failedDomains) > 0 && policy.GetRecordsPolicy != FailurePolicyPartial {
+		h.Logger.Error("Refusing to return incomplete record list", "failedDomains", failedDomains)
+		getRecordsResults.Inc("failed")
+		http.Error(w, fmt.Sprintf("Failed to list records for domains: %s", strings.Join(failedDomains, ",")), http.StatusInternalServerError)
+		return
 	}
 
-	h.Logger.Debug("Returning records", "count", len(response), "domains", len(h.DomainFilter))
+	h.Logger.Debug("Returning records", "count", len(response), "domains", len(domains))
 
 	// Marshal to JSON first to avoid chunked encoding
 	jsonData, err := json.Marshal(response)
@@ -107,6 +266,15 @@ func (h *Handler) GetRecords(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if len(failedDomains) > 0 {
+		h.Logger.Warn("Returning partial record list", "failedDomains", failedDomains, "count", len(response))
+		getRecordsResults.Inc("partial")
+		w.Header().Set(PartialResultHeader, "true")
+		w.Header().Set(FailedDomainsHeader, strings.Join(failedDomains, ","))
+	} else {
+		getRecordsResults.Inc("complete")
+	}
+
 	w.Header().Set("Content-Type", MediaTypeVersion)
 	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(jsonData)))
 	w.WriteHeader(http.StatusOK)
@@ -115,13 +283,15 @@ func (h *Handler) GetRecords(w http.ResponseWriter, r *http.Request) {
 
 // ApplyChanges applies the desired DNS record changes
 func (h *Handler) ApplyChanges(w http.ResponseWriter, r *http.Request) {
+	if !h.requireReady(w) {
+		return
+	}
 
-	// Define the request structure
-	type Changes struct {
-		Create    []*endpoint.Endpoint `json:"create"`
-		UpdateOld []*endpoint.Endpoint `json:"updateOld"`
-		UpdateNew []*endpoint.Endpoint `json:"updateNew"`
-		Delete    []*endpoint.Endpoint `json:"delete"`
+	if h.shuttingDown.Load() {
+		h.Logger.Warn("Refusing ApplyChanges during shutdown")
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
 	}
 
 	var changes Changes
@@ -131,22 +301,74 @@ func (h *Handler) ApplyChanges(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.Logger.Info("Received changes", "creates", len(changes.Create), "updates", len(changes.UpdateNew), "deletes", len(changes.Delete))
+	// Updates are sent as pairs of old and new endpoints
+	if len(changes.UpdateOld) != len(changes.UpdateNew) {
+		h.Logger.Error("Rejecting batch with unpaired updates", "updateOld", len(changes.UpdateOld), "updateNew", len(changes.UpdateNew))
+		http.Error(w, fmt.Sprintf("updateOld has %d endpoints but updateNew has %d", len(changes.UpdateOld), len(changes.UpdateNew)), http.StatusBadRequest)
+		return
+	}
+
+	batchID := newBatchID()
+	policy := h.Policy()
+	h.Logger.Info("Received changes", "batch", batchID, "creates", len(changes.Create), "updates", len(changes.UpdateNew), "deletes", len(changes.Delete))
 
 	// Log the full request for debugging
 	h.Logger.Debug("Full request payload", slog.Any("changes", changes))
 
-	// Fetch all records from all domains and build a lookup map
-	// Key: dnsName:recordType, Value: simply.Record
-	recordMap := make(map[string]simply.Record)
+	// Bring the batch into the form GetRecords reports, which older
+	// ExternalDNS versions without AdjustEndpoints do not do themselves
+	h.normalizeChanges(policy, &changes)
+
+	// Serialize mutations per zone, so concurrent batches never plan against
+	// records another batch is about to change
+	zones := h.batchZones(&changes)
+	lockTimeout := h.ZoneLockTimeout
+	if lockTimeout <= 0 {
+		lockTimeout = DefaultZoneLockTimeout
+	}
+	lockCtx, cancel := context.WithTimeout(r.Context(), lockTimeout)
+	waitStart := time.Now()
+	unlock, err := h.zoneLocks.lock(lockCtx, zones)
+	cancel()
+	wait := time.Since(waitStart)
+	if err != nil {
+		h.Logger.Warn("Timed out waiting for zone locks", "batch", batchID, "zones", zones, "wait", wait.String(), "error", err)
+		for _, zone := range zones {
+			zoneLockTimeouts.Inc(zone)
+		}
+		w.Header().Set("Retry-After", "10")
+		http.Error(w, fmt.Sprintf("Timed out waiting for zones %s to be released by another batch", strings.Join(zones, ",")), http.StatusServiceUnavailable)
+		return
+	}
+	defer unlock()
+	if wait > time.Second {
+		h.Logger.Info("Waited for zone locks", "batch", batchID, "zones", zones, "wait", wait.String())
+	} else {
+		h.Logger.Debug("Acquired zone locks", "batch", batchID, "zones", zones, "wait", wait.String())
+	}
 
-	for _, domain := range h.DomainFilter {
+	// Fetch all records from the zones touched by the batch and build a lookup map
+	// Key: dnsName:recordType, Value: the records of that endpoint
+	recordMap := make(map[string][]simply.Record)
+	zoneSizes := make(map[string]int)
+
+	touched := make(map[string]bool, len(zones))
+	for _, zone := range zones {
+		touched[zone] = true
+	}
+
+	for _, domain := range h.Domains() {
+		if !touched[domain] {
+			continue
+		}
 		records, err := h.Client.ListRecords(domain)
 		if err != nil {
 			h.Logger.Error("Failed to list records for domain", "domain", domain, "error", err)
+			listRecordsErrors.Inc(domain)
 			http.Error(w, fmt.Sprintf("Failed to list records: %v", err), http.StatusInternalServerError)
 			return
 		}
+		zoneSizes[domain] = len(records)
 
 		for _, record := range records {
 			// Build full DNS name
@@ -157,82 +379,120 @@ func (h *Handler) ApplyChanges(w http.ResponseWriter, r *http.Request) {
 				dnsName = record.Name + "." + domain
 			}
 
-			// Create lookup key: dnsName:recordType
-			key := fmt.Sprintf("%s:%s", dnsName, record.Type)
-			recordMap[key] = record
+			key := recordKey(dnsName, record.Type)
+			recordMap[key] = append(recordMap[key], record)
 		}
 	}
 
-	// Process creates
-	for _, ep := range changes.Create {
-		if err := h.createEndpoint(ep); err != nil {
-			h.Logger.Error("Failed to create endpoint", "dnsName", ep.DNSName, "error", err)
-			http.Error(w, fmt.Sprintf("Failed to create record: %v", err), http.StatusInternalServerError)
-			return
-		}
-	}
+	// Drop changes to protected records before anything else looks at the batch
+	changes = *h.filterProtected(policy, &changes)
 
-	// Process updates - compare old and new to detect actual changes
-	for i, newEp := range changes.UpdateNew {
-		oldEp := changes.UpdateOld[i]
-
-		// Check if there are actual changes
-		hasChanges := false
-		if oldEp.RecordType != newEp.RecordType {
-			hasChanges = true
-		} else if oldEp.RecordTTL != newEp.RecordTTL {
-			hasChanges = true
-		} else {
-			// Compare targets
-			for j, oldTarget := range oldEp.Targets {
-				if j >= len(newEp.Targets) || oldTarget != newEp.Targets[j] {
-					hasChanges = true
-					break
-				}
-			}
-		}
+	plan, err := h.planChanges(policy, &changes, recordMap)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to plan changes: %v", err), http.StatusInternalServerError)
+		return
+	}
 
-		if !hasChanges {
-			h.Logger.Info("Skipping update - no actual changes detected", "dnsName", newEp.DNSName, "recordType", newEp.RecordType)
-			continue
+	// Count the deletes that would actually hit Simply.com per zone
+	deletesPerZone := make(map[string]int)
+	for _, m := range plan {
+		if m.Action == simply.ActionDelete {
+			deletesPerZone[m.Domain]++
 		}
+	}
 
-		// Lookup record ID from map
-		key := fmt.Sprintf("%s:%s", newEp.DNSName, newEp.RecordType)
-		existingRecord, found := recordMap[key]
-		if !found {
-			h.Logger.Error("Record not found in map for update", "key", key)
-			http.Error(w, fmt.Sprintf("Record not found: %s", key), http.StatusInternalServerError)
+	if limitErr := policy.Limits.check(len(plan), deletesPerZone, zoneSizes); limitErr != nil {
+		if !policy.Limits.Override {
+			h.Logger.Error("Rejecting batch that exceeds safety limits", "batch", batchID, "reason", limitErr.Reason, "violations", limitErr.Violations)
+			rejectedBatches.Inc(limitErr.Reason)
+			http.Error(w, limitErr.Error(), http.StatusUnprocessableEntity)
 			return
 		}
+		h.Logger.Warn("Applying batch that exceeds safety limits because the override is enabled", "batch", batchID, "reason", limitErr.Reason, "violations", limitErr.Violations)
+	}
 
-		if err := h.updateEndpoint(newEp, existingRecord.ID); err != nil {
-			h.Logger.Error("Failed to update endpoint", "dnsName", newEp.DNSName, "error", err)
-			http.Error(w, fmt.Sprintf("Failed to update record: %v", err), http.StatusInternalServerError)
+	b := h.startBatch(batchID, plan)
+	defer h.finishBatch(b)
+
+	// Write the plan ahead of any mutation, so a crash leaves a record of
+	// what was left undone
+	var jb *journal.Batch
+	if h.Journal != nil && len(plan) > 0 {
+		jb, err = h.Journal.Begin(batchID, plan)
+		if err != nil {
+			h.Logger.Error("Failed to journal batch", "batch", batchID, "error", err)
+			http.Error(w, fmt.Sprintf("Failed to journal batch: %v", err), http.StatusInternalServerError)
 			return
 		}
+		defer func() {
+			kept, err := jb.End()
+			if err != nil {
+				h.Logger.Error("Failed to close journal", "batch", batchID, "error", err)
+			} else if kept != "" {
+				h.Logger.Warn("Batch failed partway, keeping its journal", "batch", batchID, "file", kept)
+			}
+		}()
 	}
 
-	// Process deletes - lookup record ID from map
-	for _, ep := range changes.Delete {
-		key := fmt.Sprintf("%s:%s", ep.DNSName, ep.RecordType)
-		existingRecord, found := recordMap[key]
-		if !found {
-			h.Logger.Warn("Record not found in map for deletion, skipping", "key", key)
-			continue
-		}
+	// Persist the applied records for drift detection once per batch
+	if h.Drift != nil && len(plan) > 0 {
+		defer func() {
+			if err := h.Drift.Flush(); err != nil {
+				h.Logger.Error("Failed to save applied changes for drift detection", "batch", batchID, "error", err)
+			}
+		}()
+	}
+
+	// Summarize the batch for notifications, including when it fails halfway
+	var summary *notify.Summary
+	if h.Notifier != nil && len(plan) > 0 {
+		summary = notify.NewSummary(batchID)
+		defer h.Notifier.Notify(summary)
+	}
 
-		if err := h.deleteEndpoint(ep, existingRecord.ID); err != nil {
-			h.Logger.Error("Failed to delete endpoint", "dnsName", ep.DNSName, "error", err)
-			http.Error(w, fmt.Sprintf("Failed to delete record: %v", err), http.StatusInternalServerError)
+	for i, m := range plan {
+		err := h.applyMutation(m)
+		h.audit(batchID, m, err)
+		if summary != nil {
+			summary.Add(m, err)
+		}
+		if err != nil {
+			h.Logger.Error(fmt.Sprintf("Failed to %s endpoint", m.Action), "batch", batchID, "dnsName", m.Record.Name, "error", err)
+			if jb != nil {
+				if jerr := jb.Failed(i, err); jerr != nil {
+					h.Logger.Error("Failed to write journal", "batch", batchID, "error", jerr)
+				}
+			}
+			http.Error(w, fmt.Sprintf("Failed to %s record: %v", m.Action, err), http.StatusInternalServerError)
 			return
 		}
+		b.complete()
+		if h.Drift != nil {
+			h.Drift.Record(m)
+		}
+		if jb != nil {
+			if err := jb.Done(i); err != nil {
+				h.Logger.Error("Failed to write journal", "batch", batchID, "error", err)
+			}
+		}
 	}
 
-	h.Logger.Info("Successfully applied all changes")
+	h.Logger.Info("Successfully applied all changes", "batch", batchID, "changes", len(plan))
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// audit records the outcome of a mutation in the audit sink. Audit failures
+// are logged but do not fail the batch, as the change has already been made.
+func (h *Handler) audit(batchID string, m simply.Mutation, err error) {
+	if h.Audit == nil {
+		return
+	}
+	if aerr := h.Audit.Write(audit.NewEvent(batchID, m, err)); aerr != nil {
+		auditErrors.Inc()
+		h.Logger.Error("Failed to write audit event", "batch", batchID, "mutation", m.String(), "error", aerr)
+	}
+}
+
 // AdjustEndpoints allows normalization or filtering of endpoints
 func (h *Handler) AdjustEndpoints(w http.ResponseWriter, r *http.Request) {
 
@@ -243,9 +503,11 @@ func (h *Handler) AdjustEndpoints(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Normalize endpoints (e.g., ensure trailing dots, lowercase)
+	// Normalize endpoints exactly like GetRecords does, so ExternalDNS only
+	// plans updates for endpoints that actually differ
+	policy := h.Policy()
 	for _, ep := range endpoints {
-		ep.DNSName = strings.ToLower(strings.TrimSuffix(ep.DNSName, "."))
+		h.normalizeEndpoint(policy, ep)
 	}
 
 	// Marshal to JSON first to avoid chunked encoding
@@ -262,110 +524,143 @@ func (h *Handler) AdjustEndpoints(w http.ResponseWriter, r *http.Request) {
 	w.Write(jsonData)
 }
 
-// Healthz returns health status
+// Healthz returns health status; kept for compatibility, see Livez
 func (h *Handler) Healthz(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
+	h.Livez(w, r)
 }
 
-// createEndpoint creates a new DNS record
-func (h *Handler) createEndpoint(ep *endpoint.Endpoint) error {
+// createMutations plans the creation of a DNS record for each target of an endpoint
+func (h *Handler) createMutations(p *Policy, ep *endpoint.Endpoint) ([]simply.Mutation, error) {
 	domain, err := h.extractDomain(ep.DNSName)
 	if err != nil {
-		return err
-	}
-
-	// Set default TTL if not specified
-	ttl := int(ep.RecordTTL)
-	if ttl == 0 {
-		ttl = DefaultTTL
+		return nil, err
 	}
 
 	// Create record for each target
+	var mutations []simply.Mutation
 	for _, target := range ep.Targets {
-		record := simply.Record{
-			Type:    ep.RecordType,
-			Name:    ep.DNSName,
-			Data:    target,
-			TTL:     ttl,
-			Comment: DefaultComment,
-		}
-
-		h.Logger.Info("Creating Simply.com record", "domain", domain, "name", record.Name, "type", record.Type, "data", record.Data, "ttl", record.TTL)
-
-		if err := h.Client.AddRecord(domain, record); err != nil {
-			return fmt.Errorf("failed to add record: %w", err)
-		}
+		record := h.newRecord(p, domain, ep, target)
+		mutations = append(mutations, simply.Mutation{Action: simply.ActionCreate, Domain: domain, Record: record})
 	}
 
-	return nil
+	return mutations, nil
 }
 
-// updateEndpoint updates an existing DNS record
-func (h *Handler) updateEndpoint(ep *endpoint.Endpoint, recordID int) error {
+// updateMutations plans the changes turning the existing records of an
+// endpoint into its new targets. Records of kept targets are only updated
+// when their TTL changed, and records of removed targets are reused for
+// added ones before anything is created or deleted.
+func (h *Handler) updateMutations(p *Policy, ep *endpoint.Endpoint, existing []simply.Record) ([]simply.Mutation, error) {
 	domain, err := h.extractDomain(ep.DNSName)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if len(ep.Targets) == 0 {
-		return fmt.Errorf("no targets specified for update")
+		return nil, fmt.Errorf("no targets specified for update")
 	}
 
-	// Set default TTL if not specified
-	ttl := int(ep.RecordTTL)
-	if ttl == 0 {
-		ttl = DefaultTTL
+	var mutations []simply.Mutation
+	update := func(target string, before simply.Record) {
+		record := h.newRecord(p, domain, ep, target)
+		record.ID = before.ID
+		mutations = append(mutations, simply.Mutation{Action: simply.ActionUpdate, Domain: domain, Record: record, Before: &before})
 	}
 
-	record := simply.Record{
-		ID:      recordID,
-		Type:    ep.RecordType,
-		Name:    ep.DNSName,
-		Data:    ep.Targets[0],
-		TTL:     ttl,
-		Comment: DefaultComment,
+	// Match the new targets with the existing records
+	unused := append([]simply.Record(nil), existing...)
+	var added []string
+	for _, target := range ep.Targets {
+		i := indexOfTarget(unused, target)
+		if i < 0 {
+			added = append(added, target)
+			continue
+		}
+		record := unused[i]
+		unused = append(unused[:i], unused[i+1:]...)
+		if record.TTL != h.newRecord(p, domain, ep, target).TTL {
+			update(target, record)
+		}
 	}
 
-	h.Logger.Info("Updating Simply.com record", "id", recordID, "domain", domain, "name", record.Name, "type", record.Type, "data", record.Data, "ttl", record.TTL)
+	for i, target := range added {
+		if i < len(unused) {
+			update(target, unused[i])
+			continue
+		}
+		record := h.newRecord(p, domain, ep, target)
+		mutations = append(mutations, simply.Mutation{Action: simply.ActionCreate, Domain: domain, Record: record})
+	}
 
-	if err := h.Client.UpdateRecord(domain, record); err != nil {
-		return fmt.Errorf("failed to update record: %w", err)
+	for i := len(added); i < len(unused); i++ {
+		mutation, err := h.deleteMutation(ep, unused[i])
+		if err != nil {
+			return nil, err
+		}
+		mutations = append(mutations, mutation)
 	}
 
-	return nil
+	return mutations, nil
 }
 
-// deleteEndpoint deletes a DNS record
-func (h *Handler) deleteEndpoint(ep *endpoint.Endpoint, recordID int) error {
-	domain, err := h.extractDomain(ep.DNSName)
-	if err != nil {
-		return err
+// newRecord builds the Simply.com record for one target of an endpoint
+func (h *Handler) newRecord(p *Policy, domain string, ep *endpoint.Endpoint, target string) simply.Record {
+	data, priority := recordData(ep.RecordType, target)
+	return simply.Record{
+		Type:     ep.RecordType,
+		Name:     ep.DNSName,
+		Data:     data,
+		Priority: priority,
+		// Apply the default TTL if not specified, within the allowed range
+		TTL:     p.TTL.Resolve(domain, ep.RecordType, int(ep.RecordTTL)),
+		Comment: DefaultComment,
 	}
+}
 
-	record := simply.Record{
-		ID:      recordID,
-		Type:    ep.RecordType,
-		Name:    ep.DNSName,
-		Data:    ep.Targets[0],
-		TTL:     int(ep.RecordTTL),
-		Comment: DefaultComment,
+// indexOfTarget returns the index of the record with the given target, or -1
+func indexOfTarget(records []simply.Record, target string) int {
+	for i, record := range records {
+		if recordTarget(record) == target {
+			return i
+		}
 	}
+	return -1
+}
 
-	h.Logger.Info("Deleting Simply.com record", "id", recordID, "domain", domain, "name", record.Name, "type", record.Type)
+// deleteMutation plans the deletion of a DNS record
+func (h *Handler) deleteMutation(ep *endpoint.Endpoint, existing simply.Record) (simply.Mutation, error) {
+	domain, err := h.extractDomain(ep.DNSName)
+	if err != nil {
+		return simply.Mutation{}, err
+	}
 
-	if err := h.Client.DeleteRecord(domain, record); err != nil {
-		return fmt.Errorf("failed to delete record: %w", err)
+	record := simply.Record{
+		ID:       existing.ID,
+		Type:     ep.RecordType,
+		Name:     ep.DNSName,
+		Data:     existing.Data,
+		Priority: existing.Priority,
+		TTL:      existing.TTL,
+		Comment:  DefaultComment,
 	}
 
-	return nil
+	return simply.Mutation{Action: simply.ActionDelete, Domain: domain, Record: record, Before: &existing}, nil
 }
 
-// extractDomain extracts the base domain from a DNS name
+// extractDomain returns the managed zone a DNS name belongs to: the longest
+// managed domain that is the name itself or one of its parents. Counting
+// labels instead would put www.example.co.uk in co.uk.
 func (h *Handler) extractDomain(dnsName string) (string, error) {
-	parts := strings.Split(dnsName, ".")
-	if len(parts) < 2 {
-		return "", fmt.Errorf("invalid DNS name: %s", dnsName)
+	name := canonicalName(dnsName)
+	zone := ""
+	for _, domain := range h.Domains() {
+		domain = canonicalName(domain)
+		if len(domain) > len(zone) && (name == domain || strings.HasSuffix(name, "."+domain)) {
+			zone = domain
+		}
+	}
+	if zone == "" {
+		return "", fmt.Errorf("%s is not in a managed domain", dnsName)
 	}
-	return strings.Join(parts[len(parts)-2:], "."), nil
+	return zone, nil
 }
@@ -0,0 +1,579 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/journal"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// fakeAPI is an in-memory Simply.com account. Like Simply.com, it stores
+// record names relative to their zone.
+type fakeAPI struct {
+	mu      sync.Mutex
+	zones   map[string][]simply.Record
+	nextID  int
+	applied []simply.Mutation
+
+	// listErr fails ListRecords for a domain
+	listErr map[string]error
+	// fail, when set, fails the mutations it returns an error for
+	fail func(simply.Mutation) error
+	// pingErr is returned by Ping
+	pingErr error
+}
+
+func newFakeAPI(zones map[string][]simply.Record) *fakeAPI {
+	f := &fakeAPI{zones: make(map[string][]simply.Record), nextID: 1000, listErr: make(map[string]error)}
+	for domain, records := range zones {
+		f.zones[domain] = append([]simply.Record{}, records...)
+	}
+	return f
+}
+
+func (f *fakeAPI) ListDomains() ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var domains []string
+	for domain := range f.zones {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	return domains, nil
+}
+
+func (f *fakeAPI) ListRecords(domain string) ([]simply.Record, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.listErr[domain]; err != nil {
+		return nil, err
+	}
+	records, ok := f.zones[domain]
+	if !ok {
+		return nil, fmt.Errorf("domain %s not found", domain)
+	}
+	return append([]simply.Record{}, records...), nil
+}
+
+func (f *fakeAPI) Apply(m simply.Mutation) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail != nil {
+		if err := f.fail(m); err != nil {
+			return err
+		}
+	}
+	records, ok := f.zones[m.Domain]
+	if !ok {
+		return fmt.Errorf("domain %s not found", m.Domain)
+	}
+
+	record := m.Record
+	record.Name = relativeName(record.Name, m.Domain)
+	switch m.Action {
+	case simply.ActionCreate:
+		f.nextID++
+		record.ID = f.nextID
+		records = append(records, record)
+	case simply.ActionUpdate, simply.ActionDelete:
+		i := indexOfID(records, record.ID)
+		if i < 0 {
+			return fmt.Errorf("record %d not found in %s", record.ID, m.Domain)
+		}
+		if m.Action == simply.ActionUpdate {
+			records[i] = record
+		} else {
+			records = append(records[:i], records[i+1:]...)
+		}
+	}
+	f.zones[m.Domain] = records
+	f.applied = append(f.applied, m)
+	return nil
+}
+
+func (f *fakeAPI) Status() simply.Status {
+	return simply.Status{}
+}
+
+func (f *fakeAPI) Ping() error {
+	return f.pingErr
+}
+
+// records returns the records of a zone as "name type data" sorted strings
+func (f *fakeAPI) records(domain string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []string
+	for _, r := range f.zones[domain] {
+		out = append(out, fmt.Sprintf("%s %s %s", r.Name, r.Type, recordTarget(r)))
+	}
+	sort.Strings(out)
+	return out
+}
+
+// actions returns the applied mutations as "action name type" strings
+func (f *fakeAPI) actions() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []string
+	for _, m := range f.applied {
+		out = append(out, fmt.Sprintf("%s %s %s", m.Action, m.Record.Name, m.Record.Type))
+	}
+	return out
+}
+
+func relativeName(name, domain string) string {
+	name = canonicalName(name)
+	if name == domain {
+		return "@"
+	}
+	return strings.TrimSuffix(name, "."+domain)
+}
+
+func indexOfID(records []simply.Record, id int) int {
+	for i, r := range records {
+		if r.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func newTestHandler(api simply.API, domains ...string) *Handler {
+	return NewHandler(api, slog.New(slog.NewTextHandler(io.Discard, nil)), domains)
+}
+
+// applyChanges sends a batch to ApplyChanges and returns the response
+func applyChanges(t *testing.T, h *Handler, changes Changes) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := json.Marshal(changes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	h.ApplyChanges(w, httptest.NewRequest(http.MethodPost, "/records", bytes.NewReader(body)))
+	return w
+}
+
+func record(id int, name, recordType, data string) simply.Record {
+	return simply.Record{ID: id, Name: name, Type: recordType, Data: data, TTL: DefaultTTL}
+}
+
+func TestExtractDomain(t *testing.T) {
+	h := newTestHandler(newFakeAPI(nil), "example.com", "example.co.uk", "sub.example.com")
+
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "example.com", want: "example.com"},
+		{name: "www.example.com.", want: "example.com"},
+		{name: "www.example.co.uk", want: "example.co.uk"},
+		{name: "Example.CO.uk", want: "example.co.uk"},
+		{name: "api.sub.example.com", want: "sub.example.com"},
+		{name: "www.other.co.uk", wantErr: true},
+		{name: "co.uk", wantErr: true},
+		{name: "badexample.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := h.extractDomain(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("extractDomain() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("extractDomain() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatchZones(t *testing.T) {
+	h := newTestHandler(newFakeAPI(nil), "example.com", "example.co.uk")
+	changes := &Changes{
+		Create:    []*endpoint.Endpoint{endpoint.NewEndpoint("www.example.co.uk", "A", "192.0.2.1")},
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpoint("api.example.com", "A", "192.0.2.1")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpoint("api.example.com", "A", "192.0.2.2")},
+		Delete:    []*endpoint.Endpoint{endpoint.NewEndpoint("old.example.co.uk", "A", "192.0.2.3")},
+	}
+
+	want := []string{"example.co.uk", "example.com"}
+	if got := h.batchZones(changes); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("batchZones() = %v, want %v", got, want)
+	}
+}
+
+func TestApplyChangesInMultiLabelZone(t *testing.T) {
+	api := newFakeAPI(map[string][]simply.Record{
+		"example.co.uk": {record(1, "www", "A", "192.0.2.1"), record(2, "old", "A", "192.0.2.9")},
+	})
+	h := newTestHandler(api, "example.co.uk")
+
+	w := applyChanges(t, h, Changes{
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.example.co.uk", "A", DefaultTTL, "192.0.2.1")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.example.co.uk", "A", DefaultTTL, "192.0.2.2")},
+		Delete:    []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("old.example.co.uk", "A", DefaultTTL, "192.0.2.9")},
+	})
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("ApplyChanges() = %d %s, want 204", w.Code, w.Body.String())
+	}
+
+	want := []string{"www A 192.0.2.2"}
+	if got := api.records("example.co.uk"); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("records = %v, want %v", got, want)
+	}
+}
+
+func TestApplyChangesZoneLockTimeout(t *testing.T) {
+	api := newFakeAPI(map[string][]simply.Record{"example.co.uk": nil})
+	h := newTestHandler(api, "example.co.uk")
+	h.ZoneLockTimeout = 10 * time.Millisecond
+
+	// Another batch holds the zone
+	unlock, err := h.zoneLocks.lock(context.Background(), []string{"example.co.uk"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	w := applyChanges(t, h, Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpoint("www.example.co.uk", "A", "192.0.2.1")},
+	})
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("ApplyChanges() = %d with Retry-After %q, want 503 with Retry-After", w.Code, w.Header().Get("Retry-After"))
+	}
+	if len(api.actions()) != 0 {
+		t.Errorf("mutations applied while the zone was locked: %v", api.actions())
+	}
+}
+
+func TestPolicyInMultiLabelZone(t *testing.T) {
+	api := newFakeAPI(map[string][]simply.Record{
+		"example.co.uk": {record(1, "@", "MX", "mail.example.co.uk")},
+	})
+	api.zones["example.co.uk"][0].Priority = 10
+	h := newTestHandler(api, "example.co.uk")
+	policy := DefaultPolicy()
+	policy.Protected = ProtectedRecords{{Name: "@", Type: "MX"}}
+	policy.TTL.Domains = map[string]DomainTTL{"example.co.uk": {Default: 900}}
+	h.SetPolicy(policy)
+
+	w := applyChanges(t, h, Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpoint("www.example.co.uk", "A", "192.0.2.1")},
+		Delete: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("example.co.uk", "MX", DefaultTTL, "10 mail.example.co.uk")},
+	})
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("ApplyChanges() = %d %s, want 204", w.Code, w.Body.String())
+	}
+
+	want := []string{"create www.example.co.uk A"}
+	if got := api.actions(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("applied = %v, want %v", got, want)
+	}
+	if ttl := api.applied[0].Record.TTL; ttl != 900 {
+		t.Errorf("created record TTL = %d, want the example.co.uk default 900", ttl)
+	}
+}
+
+func TestLockZoneExcludesApplyChanges(t *testing.T) {
+	api := newFakeAPI(map[string][]simply.Record{"example.co.uk": nil})
+	h := newTestHandler(api, "example.co.uk")
+	h.ZoneLockTimeout = 10 * time.Millisecond
+
+	// A drift check reads the zone
+	unlock, err := h.LockZone(context.Background(), "Example.CO.uk.")
+	if err != nil {
+		t.Fatalf("LockZone() error = %v", err)
+	}
+	changes := Changes{Create: []*endpoint.Endpoint{endpoint.NewEndpoint("www.example.co.uk", "A", "192.0.2.1")}}
+	if w := applyChanges(t, h, changes); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("ApplyChanges() while the zone is read = %d, want 503", w.Code)
+	}
+	if _, err := h.LockZone(context.Background(), "example.co.uk"); err == nil {
+		t.Error("LockZone() acquired a zone that is already locked")
+	}
+
+	unlock()
+	if w := applyChanges(t, h, changes); w.Code != http.StatusNoContent {
+		t.Errorf("ApplyChanges() after the read = %d %s, want 204", w.Code, w.Body.String())
+	}
+}
+
+// getRecords calls GetRecords and returns the response
+func getRecords(h *Handler) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.GetRecords(w, httptest.NewRequest(http.MethodGet, "/records", nil))
+	return w
+}
+
+func TestGetRecordsFailurePolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      FailurePolicy
+		failing     string
+		wantCode    int
+		wantFailed  string
+		wantRecords []string
+	}{
+		{
+			name:        "complete",
+			policy:      FailurePolicyFail,
+			wantCode:    http.StatusOK,
+			wantRecords: []string{"www.example.com A", "www.example.org A"},
+		},
+		{
+			name:     "fail policy refuses an incomplete list",
+			policy:   FailurePolicyFail,
+			failing:  "example.org",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:        "partial policy flags the missing domains",
+			policy:      FailurePolicyPartial,
+			failing:     "example.org",
+			wantCode:    http.StatusOK,
+			wantFailed:  "example.org",
+			wantRecords: []string{"www.example.com A"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newFakeAPI(map[string][]simply.Record{
+				"example.com": {record(1, "www", "A", "192.0.2.1")},
+				"example.org": {record(2, "www", "A", "192.0.2.2")},
+			})
+			if tt.failing != "" {
+				api.listErr[tt.failing] = fmt.Errorf("simply.com unavailable")
+			}
+			h := newTestHandler(api, "example.com", "example.org")
+			policy := DefaultPolicy()
+			policy.GetRecordsPolicy = tt.policy
+			h.SetPolicy(policy)
+
+			w := getRecords(h)
+			if w.Code != tt.wantCode {
+				t.Fatalf("GetRecords() = %d %s, want %d", w.Code, w.Body.String(), tt.wantCode)
+			}
+			partial := w.Header().Get(PartialResultHeader)
+			if (partial == "true") != (tt.wantFailed != "") || w.Header().Get(FailedDomainsHeader) != tt.wantFailed {
+				t.Errorf("headers %s=%q %s=%q, want failed domains %q", PartialResultHeader, partial, FailedDomainsHeader, w.Header().Get(FailedDomainsHeader), tt.wantFailed)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var endpoints []*endpoint.Endpoint
+			if err := json.Unmarshal(w.Body.Bytes(), &endpoints); err != nil {
+				t.Fatalf("invalid response %s: %v", w.Body.String(), err)
+			}
+			var got []string
+			for _, ep := range endpoints {
+				got = append(got, ep.DNSName+" "+ep.RecordType)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(tt.wantRecords, ",") {
+				t.Errorf("records = %v, want %v", got, tt.wantRecords)
+			}
+		})
+	}
+}
+
+func TestGetRecordsGroupsRecordSets(t *testing.T) {
+	api := newFakeAPI(map[string][]simply.Record{
+		"example.com": {
+			record(1, "www", "A", "192.0.2.2"),
+			record(2, "www", "A", "192.0.2.1"),
+			{ID: 3, Name: "@", Type: "MX", Data: "mail.example.com", Priority: 10, TTL: 300},
+		},
+	})
+	api.zones["example.com"][1].TTL = 600
+	h := newTestHandler(api, "example.com")
+
+	w := getRecords(h)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GetRecords() = %d %s, want 200", w.Code, w.Body.String())
+	}
+	var endpoints []*endpoint.Endpoint
+	if err := json.Unmarshal(w.Body.Bytes(), &endpoints); err != nil {
+		t.Fatalf("invalid response %s: %v", w.Body.String(), err)
+	}
+	var got []string
+	for _, ep := range endpoints {
+		got = append(got, fmt.Sprintf("%s %s %d %s", ep.DNSName, ep.RecordType, ep.RecordTTL, strings.Join(ep.Targets, "|")))
+	}
+	sort.Strings(got)
+	want := []string{
+		"example.com MX 300 10 mail.example.com",
+		"www.example.com A 600 192.0.2.1|192.0.2.2",
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("endpoints = %v, want %v", got, want)
+	}
+}
+
+func TestApplyChangesOrder(t *testing.T) {
+	api := newFakeAPI(map[string][]simply.Record{
+		"example.com": {record(1, "api", "A", "192.0.2.1"), record(2, "old", "A", "192.0.2.2")},
+	})
+	h := newTestHandler(api, "example.com")
+
+	w := applyChanges(t, h, Changes{
+		Delete:    []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("old.example.com", "A", DefaultTTL, "192.0.2.2")},
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("api.example.com", "A", DefaultTTL, "192.0.2.1")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("api.example.com", "A", DefaultTTL, "192.0.2.3")},
+		Create:    []*endpoint.Endpoint{endpoint.NewEndpoint("www.example.com", "A", "192.0.2.4")},
+	})
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("ApplyChanges() = %d %s, want 204", w.Code, w.Body.String())
+	}
+
+	want := []string{"create www.example.com A", "update api.example.com A", "delete old.example.com A"}
+	if got := api.actions(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("applied = %v, want %v", got, want)
+	}
+	wantRecords := []string{"api A 192.0.2.3", "www A 192.0.2.4"}
+	if got := api.records("example.com"); strings.Join(got, ",") != strings.Join(wantRecords, ",") {
+		t.Errorf("records = %v, want %v", got, wantRecords)
+	}
+}
+
+func TestApplyChangesSafetyLimits(t *testing.T) {
+	deletes := Changes{Delete: []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("a.example.com", "A", DefaultTTL, "192.0.2.1"),
+		endpoint.NewEndpointWithTTL("b.example.com", "A", DefaultTTL, "192.0.2.2"),
+	}}
+
+	tests := []struct {
+		name       string
+		limits     SafetyLimits
+		wantCode   int
+		wantDelete int
+	}{
+		{name: "within limits", limits: SafetyLimits{MaxDeletes: 2}, wantCode: http.StatusNoContent, wantDelete: 2},
+		{name: "too many deletes", limits: SafetyLimits{MaxDeletes: 1}, wantCode: http.StatusUnprocessableEntity},
+		{name: "too large a share of the zone", limits: SafetyLimits{MaxDeletePercent: 50}, wantCode: http.StatusUnprocessableEntity},
+		{name: "too many changes", limits: SafetyLimits{MaxChanges: 1}, wantCode: http.StatusUnprocessableEntity},
+		{name: "override", limits: SafetyLimits{MaxDeletes: 1, Override: true}, wantCode: http.StatusNoContent, wantDelete: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newFakeAPI(map[string][]simply.Record{
+				"example.com": {record(1, "a", "A", "192.0.2.1"), record(2, "b", "A", "192.0.2.2"), record(3, "c", "A", "192.0.2.3")},
+			})
+			h := newTestHandler(api, "example.com")
+			policy := DefaultPolicy()
+			policy.Limits = tt.limits
+			h.SetPolicy(policy)
+
+			w := applyChanges(t, h, deletes)
+			if w.Code != tt.wantCode {
+				t.Fatalf("ApplyChanges() = %d %s, want %d", w.Code, w.Body.String(), tt.wantCode)
+			}
+			if got := len(api.actions()); got != tt.wantDelete {
+				t.Errorf("applied %d mutations, want %d: %v", got, tt.wantDelete, api.actions())
+			}
+		})
+	}
+}
+
+func TestRequestsWaitForDomainDiscovery(t *testing.T) {
+	api := newFakeAPI(map[string][]simply.Record{
+		"example.com": {record(1, "www", "A", "192.0.2.1")},
+		"example.org": {record(2, "www", "A", "192.0.2.2")},
+	})
+	h := newTestHandler(api)
+
+	requests := map[string]func() *httptest.ResponseRecorder{
+		"Negotiate": func() *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			h.Negotiate(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			return w
+		},
+		"GetRecords": func() *httptest.ResponseRecorder { return getRecords(h) },
+		"ApplyChanges": func() *httptest.ResponseRecorder {
+			return applyChanges(t, h, Changes{Create: []*endpoint.Endpoint{endpoint.NewEndpoint("api.example.com", "A", "192.0.2.3")}})
+		},
+	}
+
+	for name, request := range requests {
+		if w := request(); w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+			t.Errorf("%s before discovery = %d with Retry-After %q, want 503 with Retry-After", name, w.Code, w.Header().Get("Retry-After"))
+		}
+	}
+	if len(api.actions()) != 0 {
+		t.Fatalf("mutations applied before discovery: %v", api.actions())
+	}
+
+	h.SetDomains([]string{"example.com"})
+	if w := requests["Negotiate"](); w.Code != http.StatusOK {
+		t.Errorf("Negotiate after discovery = %d, want 200", w.Code)
+	}
+	if w := requests["ApplyChanges"](); w.Code != http.StatusNoContent {
+		t.Errorf("ApplyChanges after discovery = %d %s, want 204", w.Code, w.Body.String())
+	}
+	if w := getRecords(h); w.Code != http.StatusOK || strings.Contains(w.Body.String(), "example.org") {
+		t.Errorf("GetRecords after discovery = %d %s, want 200 without example.org", w.Code, w.Body.String())
+	}
+
+	// A later discovery picks up new domains without a restart
+	h.SetDomains([]string{"example.com", "example.org"})
+	if w := getRecords(h); !strings.Contains(w.Body.String(), "www.example.org") {
+		t.Errorf("GetRecords after re-discovery = %s, want www.example.org", w.Body.String())
+	}
+}
+
+func TestApplyChangesPartialFailure(t *testing.T) {
+	api := newFakeAPI(map[string][]simply.Record{
+		"example.com": {record(1, "api", "A", "192.0.2.1"), record(2, "old", "A", "192.0.2.2")},
+	})
+	api.fail = func(m simply.Mutation) error {
+		if m.Action == simply.ActionUpdate {
+			return fmt.Errorf("simply.com rejected the update")
+		}
+		return nil
+	}
+	h := newTestHandler(api, "example.com")
+	dir := t.TempDir()
+	j, err := journal.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Journal = j
+
+	w := applyChanges(t, h, Changes{
+		Create:    []*endpoint.Endpoint{endpoint.NewEndpoint("www.example.com", "A", "192.0.2.4")},
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("api.example.com", "A", DefaultTTL, "192.0.2.1")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("api.example.com", "A", DefaultTTL, "192.0.2.3")},
+		Delete:    []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("old.example.com", "A", DefaultTTL, "192.0.2.2")},
+	})
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("ApplyChanges() = %d %s, want 500", w.Code, w.Body.String())
+	}
+
+	// The batch stops at the failure: the delete after it is never sent
+	if got := api.actions(); strings.Join(got, ",") != "create www.example.com A" {
+		t.Errorf("applied = %v, want only the create", got)
+	}
+	kept, err := filepath.Glob(filepath.Join(dir, "*.incomplete"))
+	if err != nil || len(kept) != 1 {
+		t.Errorf("incomplete journals = %v, %v, want one", kept, err)
+	}
+}
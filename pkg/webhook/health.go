@@ -0,0 +1,151 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
+)
+
+// DefaultHealthCacheTTL is how long an upstream check result is reused, so
+// frequent probes do not hammer the Simply.com API
+const DefaultHealthCacheTTL = time.Minute
+
+// CheckResult is the outcome of a single readiness check
+type CheckResult struct {
+	OK      bool      `json:"ok"`
+	Message string    `json:"message,omitempty"`
+	Checked time.Time `json:"checked,omitempty"`
+}
+
+// HealthReport is the detailed health view returned by the Health endpoint
+type HealthReport struct {
+	Ready   bool                   `json:"ready"`
+	Checks  map[string]CheckResult `json:"checks"`
+	Domains []string               `json:"domains"`
+	Simply  simply.Status          `json:"simply"`
+	// Accounts is the status of each account when several are configured
+	Accounts map[string]simply.Status `json:"accounts,omitempty"`
+}
+
+// upstreamCheck caches the result of the last Simply.com probe
+type upstreamCheck struct {
+	mu      sync.Mutex
+	checked time.Time
+	err     error
+}
+
+// checkUpstream verifies that Simply.com is reachable and accepts our
+// credentials. A recent successful API call counts as a passing check;
+// otherwise the account is probed at most once per HealthCacheTTL.
+func (h *Handler) checkUpstream() (credentials, api CheckResult) {
+	ttl := h.HealthCacheTTL
+	if ttl <= 0 {
+		ttl = DefaultHealthCacheTTL
+	}
+
+	status := h.Client.Status()
+	if time.Since(status.LastSuccess) < ttl && status.LastSuccess.After(status.LastFailure) {
+		ok := CheckResult{OK: true, Checked: status.LastSuccess}
+		return ok, ok
+	}
+
+	h.upstream.mu.Lock()
+	defer h.upstream.mu.Unlock()
+
+	if h.upstream.checked.IsZero() || time.Since(h.upstream.checked) >= ttl {
+		err := h.Client.Ping()
+		h.upstream.checked = time.Now()
+		h.upstream.err = err
+		if err != nil {
+			h.Logger.Warn("Simply.com health probe failed", "error", err)
+		}
+	}
+
+	credentials = CheckResult{OK: true, Checked: h.upstream.checked}
+	api = CheckResult{OK: true, Checked: h.upstream.checked}
+	if err := h.upstream.err; err != nil {
+		api = CheckResult{OK: false, Message: err.Error(), Checked: h.upstream.checked}
+		if simply.IsAuthError(err) {
+			credentials = CheckResult{OK: false, Message: "Simply.com rejected the credentials", Checked: h.upstream.checked}
+		}
+	}
+	return credentials, api
+}
+
+// healthReport runs all readiness checks
+func (h *Handler) healthReport() HealthReport {
+	report := HealthReport{
+		Checks:  make(map[string]CheckResult),
+		Domains: h.Domains(),
+	}
+
+	if h.Ready() {
+		report.Checks["discovery"] = CheckResult{OK: true, Message: fmt.Sprintf("%d domains", len(report.Domains))}
+		report.Checks["credentials"], report.Checks["simply"] = h.checkUpstream()
+	} else {
+		report.Checks["discovery"] = CheckResult{OK: false, Message: "domain discovery in progress"}
+	}
+	report.Simply = h.Client.Status()
+	if accounts, ok := h.Client.(*simply.Accounts); ok && len(accounts.Accounts()) > 1 {
+		report.Accounts = accounts.Statuses()
+	}
+
+	report.Ready = true
+	for _, check := range report.Checks {
+		if !check.OK {
+			report.Ready = false
+		}
+	}
+	return report
+}
+
+// Livez reports whether the process is alive; it never calls Simply.com
+func (h *Handler) Livez(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
+// Readyz reports whether the webhook is ready to serve records: domains are
+// discovered, Simply.com answered recently and the credentials are valid
+func (h *Handler) Readyz(w http.ResponseWriter, r *http.Request) {
+	report := h.healthReport()
+	if !report.Ready {
+		var failed []string
+		for name, check := range report.Checks {
+			if !check.OK {
+				failed = append(failed, fmt.Sprintf("%s: %s", name, check.Message))
+			}
+		}
+		http.Error(w, "Not ready: "+strings.Join(failed, "; "), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
+// Health returns the detailed health view as JSON for debugging
+func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
+	report := h.healthReport()
+
+	jsonData, err := json.Marshal(report)
+	if err != nil {
+		h.Logger.Error("Failed to marshal health report", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusOK
+	if !report.Ready {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(jsonData)))
+	w.WriteHeader(status)
+	w.Write(jsonData)
+}
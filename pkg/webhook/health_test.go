@@ -0,0 +1,116 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
+)
+
+// countingAPI counts the Simply.com health probes
+type countingAPI struct {
+	*fakeAPI
+	pings int
+}
+
+func (c *countingAPI) Ping() error {
+	c.pings++
+	return c.fakeAPI.Ping()
+}
+
+func probe(handler http.HandlerFunc) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	return w
+}
+
+func TestReadyz(t *testing.T) {
+	tests := []struct {
+		name     string
+		domains  []string
+		pingErr  error
+		wantCode int
+		wantBody string
+	}{
+		{name: "ready", domains: []string{"example.com"}, wantCode: http.StatusOK, wantBody: "OK"},
+		{name: "discovery pending", wantCode: http.StatusServiceUnavailable, wantBody: "discovery"},
+		{
+			name:     "Simply.com unreachable",
+			domains:  []string{"example.com"},
+			pingErr:  errors.New("connection refused"),
+			wantCode: http.StatusServiceUnavailable,
+			wantBody: "connection refused",
+		},
+		{
+			name:     "credentials rejected",
+			domains:  []string{"example.com"},
+			pingErr:  &simply.APIError{StatusCode: http.StatusUnauthorized},
+			wantCode: http.StatusServiceUnavailable,
+			wantBody: "rejected the credentials",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newFakeAPI(nil)
+			api.pingErr = tt.pingErr
+			h := newTestHandler(api, tt.domains...)
+
+			w := probe(h.Readyz)
+			if w.Code != tt.wantCode || !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("Readyz() = %d %q, want %d containing %q", w.Code, w.Body.String(), tt.wantCode, tt.wantBody)
+			}
+			if w := probe(h.Livez); w.Code != http.StatusOK {
+				t.Errorf("Livez() = %d, want 200 regardless of readiness", w.Code)
+			}
+		})
+	}
+}
+
+func TestReadyzCachesUpstreamProbe(t *testing.T) {
+	api := &countingAPI{fakeAPI: newFakeAPI(nil)}
+	h := newTestHandler(api, "example.com")
+	h.HealthCacheTTL = time.Hour
+
+	for i := 0; i < 3; i++ {
+		if w := probe(h.Readyz); w.Code != http.StatusOK {
+			t.Fatalf("Readyz() = %d %s, want 200", w.Code, w.Body.String())
+		}
+	}
+	if api.pings != 1 {
+		t.Errorf("Simply.com probed %d times, want 1 within the cache TTL", api.pings)
+	}
+
+	// Discovery pending never calls Simply.com
+	pending := &countingAPI{fakeAPI: newFakeAPI(nil)}
+	probe(newTestHandler(pending).Readyz)
+	if pending.pings != 0 {
+		t.Errorf("Simply.com probed %d times before discovery, want 0", pending.pings)
+	}
+}
+
+func TestHealthReport(t *testing.T) {
+	api := newFakeAPI(nil)
+	api.pingErr = errors.New("timeout")
+	h := newTestHandler(api, "example.com")
+
+	w := probe(h.Health)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Health() = %d, want 503", w.Code)
+	}
+	var report HealthReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("invalid report %s: %v", w.Body.String(), err)
+	}
+	if report.Ready || !report.Checks["discovery"].OK || report.Checks["simply"].OK || !report.Checks["credentials"].OK {
+		t.Errorf("report = %+v, want discovery and credentials ok, simply failing", report)
+	}
+	if strings.Join(report.Domains, ",") != "example.com" {
+		t.Errorf("Domains = %v, want [example.com]", report.Domains)
+	}
+}
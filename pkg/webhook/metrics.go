@@ -0,0 +1,35 @@
+package webhook
+
+import "github.com/uozalp/external-dns-simply-webhook/pkg/metrics"
+
+var (
+	listRecordsErrors = metrics.NewCounterVec(
+		"simply_webhook_list_records_errors_total",
+		"Number of failed Simply.com record listings per domain.",
+		"domain",
+	)
+	getRecordsResults = metrics.NewCounterVec(
+		"simply_webhook_get_records_total",
+		"Number of GetRecords responses by result (complete, partial, failed).",
+		"result",
+	)
+	rejectedBatches = metrics.NewCounterVec(
+		"simply_webhook_rejected_batches_total",
+		"Number of ApplyChanges batches rejected by safety limits, by reason.",
+		"reason",
+	)
+	protectedChangesSkipped = metrics.NewCounterVec(
+		"simply_webhook_protected_changes_skipped_total",
+		"Number of changes to protected records refused by ApplyChanges, by action.",
+		"action",
+	)
+	zoneLockTimeouts = metrics.NewCounterVec(
+		"simply_webhook_zone_lock_timeouts_total",
+		"Number of ApplyChanges batches that timed out waiting for a zone lock, by zone.",
+		"zone",
+	)
+	auditErrors = metrics.NewCounterVec(
+		"simply_webhook_audit_errors_total",
+		"Number of mutations that could not be written to the audit sink.",
+	)
+)
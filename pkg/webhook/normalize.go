@@ -0,0 +1,132 @@
+package webhook
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// hostnameTypes are record types whose target is a host name
+var hostnameTypes = map[string]bool{
+	"CNAME": true,
+	"NS":    true,
+	"PTR":   true,
+	"ALIAS": true,
+}
+
+// normalizeEndpoint brings an endpoint into the canonical form used for both
+// the desired endpoints (AdjustEndpoints) and the current ones (GetRecords),
+// so ExternalDNS sees identical endpoints when nothing needs to change.
+// Names are lowercased without trailing dot, targets formatted per record
+// type, deduplicated and sorted, and the TTL resolved against the policy.
+func (h *Handler) normalizeEndpoint(p *Policy, ep *endpoint.Endpoint) {
+	ep.DNSName = canonicalName(ep.DNSName)
+	ep.RecordType = strings.ToUpper(strings.TrimSpace(ep.RecordType))
+
+	targets := make(endpoint.Targets, 0, len(ep.Targets))
+	seen := make(map[string]bool, len(ep.Targets))
+	for _, target := range ep.Targets {
+		target = normalizeTarget(ep.RecordType, target)
+		if seen[target] {
+			continue
+		}
+		seen[target] = true
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	ep.Targets = targets
+
+	if zone, err := h.extractDomain(ep.DNSName); err == nil {
+		ep.RecordTTL = endpoint.TTL(p.TTL.Resolve(zone, ep.RecordType, int(ep.RecordTTL)))
+	}
+}
+
+// normalizeChanges normalizes every endpoint of a batch, so batches from
+// ExternalDNS versions that skip AdjustEndpoints are planned the same way
+func (h *Handler) normalizeChanges(p *Policy, changes *Changes) {
+	for _, endpoints := range [][]*endpoint.Endpoint{changes.Create, changes.UpdateOld, changes.UpdateNew, changes.Delete} {
+		for _, ep := range endpoints {
+			h.normalizeEndpoint(p, ep)
+		}
+	}
+}
+
+// canonicalName lowercases a host name and removes its trailing dot
+func canonicalName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+}
+
+// normalizeTarget formats a target of the given record type canonically:
+// IP addresses in their shortest form, host names via canonicalName and MX
+// and SRV targets as "priority host" and "priority weight port host".
+// Targets that cannot be parsed are returned trimmed but otherwise unchanged.
+func normalizeTarget(recordType, target string) string {
+	target = strings.TrimSpace(target)
+
+	switch recordType {
+	case "A", "AAAA":
+		if ip := net.ParseIP(target); ip != nil {
+			return ip.String()
+		}
+	case "MX":
+		fields := strings.Fields(target)
+		if len(fields) == 2 {
+			if priority, err := strconv.Atoi(fields[0]); err == nil {
+				return fmt.Sprintf("%d %s", priority, canonicalName(fields[1]))
+			}
+		}
+	case "SRV":
+		fields := strings.Fields(target)
+		if len(fields) == 4 {
+			numbers := make([]int, 3)
+			for i := range numbers {
+				n, err := strconv.Atoi(fields[i])
+				if err != nil {
+					return target
+				}
+				numbers[i] = n
+			}
+			return fmt.Sprintf("%d %d %d %s", numbers[0], numbers[1], numbers[2], canonicalName(fields[3]))
+		}
+	default:
+		if hostnameTypes[recordType] {
+			return canonicalName(target)
+		}
+	}
+	return target
+}
+
+// recordTarget returns the ExternalDNS target of a Simply.com record. Simply.com
+// keeps the priority of MX and SRV records apart from their data, while
+// ExternalDNS expects it as the first field of the target.
+func recordTarget(record simply.Record) string {
+	recordType := strings.ToUpper(record.Type)
+	data := strings.TrimSpace(record.Data)
+
+	switch {
+	case recordType == "MX" && len(strings.Fields(data)) == 1,
+		recordType == "SRV" && len(strings.Fields(data)) == 3:
+		data = fmt.Sprintf("%d %s", record.Priority, data)
+	}
+	return normalizeTarget(recordType, data)
+}
+
+// recordData splits an ExternalDNS target into the data and priority of a
+// Simply.com record, the reverse of recordTarget
+func recordData(recordType, target string) (string, int) {
+	fields := strings.Fields(target)
+
+	switch {
+	case recordType == "MX" && len(fields) == 2,
+		recordType == "SRV" && len(fields) == 4:
+		if priority, err := strconv.Atoi(fields[0]); err == nil {
+			return strings.Join(fields[1:], " "), priority
+		}
+	}
+	return target, 0
+}
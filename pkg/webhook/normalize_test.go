@@ -0,0 +1,154 @@
+package webhook
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"reflect"
+	"testing"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func TestNormalizeTarget(t *testing.T) {
+	tests := []struct {
+		recordType string
+		target     string
+		want       string
+	}{
+		{"A", " 192.0.2.1 ", "192.0.2.1"},
+		{"AAAA", "2001:DB8:0:0:0:0:0:1", "2001:db8::1"},
+		{"A", "not-an-ip", "not-an-ip"},
+		{"CNAME", "Target.Example.com.", "target.example.com"},
+		{"NS", "NS1.example.com.", "ns1.example.com"},
+		{"MX", "10  Mail.Example.com.", "10 mail.example.com"},
+		{"MX", "010 mail.example.com", "10 mail.example.com"},
+		{"MX", "mail.example.com", "mail.example.com"},
+		{"SRV", "10 5 443 SIP.example.com.", "10 5 443 sip.example.com"},
+		{"SRV", "10 x 443 sip.example.com", "10 x 443 sip.example.com"},
+		{"TXT", " \"v=spf1 -all\" ", "\"v=spf1 -all\""},
+		{"TXT", "Case Is Kept.", "Case Is Kept."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.recordType+" "+tt.target, func(t *testing.T) {
+			if got := normalizeTarget(tt.recordType, tt.target); got != tt.want {
+				t.Errorf("normalizeTarget(%q, %q) = %q, want %q", tt.recordType, tt.target, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordTarget(t *testing.T) {
+	tests := []struct {
+		name   string
+		record simply.Record
+		want   string
+	}{
+		{name: "A", record: simply.Record{Type: "A", Data: "192.0.2.1"}, want: "192.0.2.1"},
+		{name: "lowercase type", record: simply.Record{Type: "cname", Data: "Target.example.com."}, want: "target.example.com"},
+		{name: "MX priority", record: simply.Record{Type: "MX", Data: "mail.example.com", Priority: 10}, want: "10 mail.example.com"},
+		{name: "MX zero priority", record: simply.Record{Type: "MX", Data: "mail.example.com"}, want: "0 mail.example.com"},
+		{name: "MX priority in data", record: simply.Record{Type: "MX", Data: "20 mail.example.com", Priority: 10}, want: "20 mail.example.com"},
+		{name: "SRV priority", record: simply.Record{Type: "SRV", Data: "5 443 sip.example.com", Priority: 10}, want: "10 5 443 sip.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := recordTarget(tt.record); got != tt.want {
+				t.Errorf("recordTarget(%+v) = %q, want %q", tt.record, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordDataRoundTrip(t *testing.T) {
+	for _, record := range []simply.Record{
+		{Type: "A", Data: "192.0.2.1"},
+		{Type: "MX", Data: "mail.example.com", Priority: 10},
+		{Type: "SRV", Data: "5 443 sip.example.com", Priority: 10},
+	} {
+		data, priority := recordData(record.Type, recordTarget(record))
+		if data != record.Data || priority != record.Priority {
+			t.Errorf("recordData(recordTarget(%+v)) = %q, %d", record, data, priority)
+		}
+	}
+}
+
+func TestUpdateMutations(t *testing.T) {
+	h := NewHandler(nil, slog.New(slog.NewTextHandler(io.Discard, nil)), []string{"example.com"})
+	p := DefaultPolicy()
+
+	a := func(id int, data string, ttl int) simply.Record {
+		return simply.Record{ID: id, Type: "A", Name: "www.example.com", Data: data, TTL: ttl}
+	}
+	mx := func(id int, data string, priority int) simply.Record {
+		return simply.Record{ID: id, Type: "MX", Name: "example.com", Data: data, Priority: priority, TTL: 3600}
+	}
+
+	tests := []struct {
+		name     string
+		endpoint *endpoint.Endpoint
+		existing []simply.Record
+		want     []string
+	}{
+		{
+			name:     "unchanged",
+			endpoint: endpoint.NewEndpointWithTTL("www.example.com", "A", 3600, "192.0.2.1", "192.0.2.2"),
+			existing: []simply.Record{a(1, "192.0.2.2", 3600), a(2, "192.0.2.1", 3600)},
+		},
+		{
+			name:     "TTL changed",
+			endpoint: endpoint.NewEndpointWithTTL("www.example.com", "A", 300, "192.0.2.1", "192.0.2.2"),
+			existing: []simply.Record{a(1, "192.0.2.1", 3600), a(2, "192.0.2.2", 3600)},
+			want:     []string{"update 1 192.0.2.1 0 300", "update 2 192.0.2.2 0 300"},
+		},
+		{
+			name:     "target replaced reuses the record",
+			endpoint: endpoint.NewEndpointWithTTL("www.example.com", "A", 3600, "192.0.2.1", "192.0.2.3"),
+			existing: []simply.Record{a(1, "192.0.2.1", 3600), a(2, "192.0.2.2", 3600)},
+			want:     []string{"update 2 192.0.2.3 0 3600"},
+		},
+		{
+			name:     "target added",
+			endpoint: endpoint.NewEndpointWithTTL("www.example.com", "A", 3600, "192.0.2.1", "192.0.2.2"),
+			existing: []simply.Record{a(1, "192.0.2.1", 3600)},
+			want:     []string{"create 0 192.0.2.2 0 3600"},
+		},
+		{
+			name:     "target removed",
+			endpoint: endpoint.NewEndpointWithTTL("www.example.com", "A", 3600, "192.0.2.2"),
+			existing: []simply.Record{a(1, "192.0.2.1", 3600), a(2, "192.0.2.2", 3600)},
+			want:     []string{"delete 1 192.0.2.1 0 3600"},
+		},
+		{
+			name:     "MX matched with its priority",
+			endpoint: endpoint.NewEndpointWithTTL("example.com", "MX", 3600, "10 mail.example.com", "20 backup.example.com"),
+			existing: []simply.Record{mx(1, "backup.example.com", 20), mx(2, "mail.example.com", 10)},
+		},
+		{
+			name:     "MX priority changed",
+			endpoint: endpoint.NewEndpointWithTTL("example.com", "MX", 3600, "5 mail.example.com"),
+			existing: []simply.Record{mx(1, "mail.example.com", 10)},
+			want:     []string{"update 1 mail.example.com 5 3600"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mutations, err := h.updateMutations(p, tt.endpoint, tt.existing)
+			if err != nil {
+				t.Fatalf("updateMutations() error = %v", err)
+			}
+
+			var got []string
+			for _, m := range mutations {
+				got = append(got, fmt.Sprintf("%s %d %s %d %d", m.Action, m.Record.ID, m.Record.Data, m.Record.Priority, m.Record.TTL))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("updateMutations() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package webhook
+
+import "github.com/uozalp/external-dns-simply-webhook/pkg/domains"
+
+// Policy holds the handler settings that can be changed while the webhook is
+// running. It is replaced as a whole, and every request works on the policy
+// it started with, so a reload never applies halfway through a batch.
+type Policy struct {
+	// Filter is the configured domain filter, reported to ExternalDNS in the
+	// Negotiate response
+	Filter domains.Filter
+
+	// GetRecordsPolicy decides what GetRecords returns when a domain fails to list
+	GetRecordsPolicy FailurePolicy
+
+	// Limits are the guardrails applied to every ApplyChanges batch
+	Limits SafetyLimits
+
+	// TTL decides the TTL of created and updated records
+	TTL TTLPolicy
+
+	// Protected records are never created, updated or deleted by ApplyChanges
+	Protected ProtectedRecords
+	// HideProtected omits protected records from GetRecords
+	HideProtected bool
+}
+
+// DefaultPolicy returns the policy of a handler that has not been configured
+func DefaultPolicy() *Policy {
+	return &Policy{
+		GetRecordsPolicy: FailurePolicyFail,
+		TTL:              TTLPolicy{Default: DefaultTTL},
+	}
+}
+
+// Policy returns the policy currently in effect. It must not be modified.
+func (h *Handler) Policy() *Policy {
+	return h.policy.Load()
+}
+
+// SetPolicy atomically replaces the policy. Requests already in flight keep
+// using the policy they started with.
+func (h *Handler) SetPolicy(p *Policy) {
+	h.policy.Store(p)
+}
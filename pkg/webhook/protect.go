@@ -0,0 +1,121 @@
+package webhook
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ProtectedRecord matches Simply.com records the webhook must never modify
+type ProtectedRecord struct {
+	// Name is a glob pattern matched against both the fully qualified record
+	// name and the name relative to its zone ("@" for the apex)
+	Name string
+	// Type is the record type to protect; empty or "*" matches any type
+	Type string
+}
+
+// ProtectedRecords is a list of protected record patterns
+type ProtectedRecords []ProtectedRecord
+
+// ParseProtectedRecords parses a comma-separated list of name[:TYPE] entries,
+// e.g. "@:MX,_dmarc:TXT,www.example.com:CNAME,*._domainkey"
+func ParseProtectedRecords(s string) (ProtectedRecords, error) {
+	var protected ProtectedRecords
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, recordType, _ := strings.Cut(entry, ":")
+		name = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+		recordType = strings.ToUpper(strings.TrimSpace(recordType))
+		if name == "" {
+			return nil, fmt.Errorf("invalid protected record %q: missing name", entry)
+		}
+		if _, err := path.Match(name, ""); err != nil {
+			return nil, fmt.Errorf("invalid protected record %q: %w", entry, err)
+		}
+
+		protected = append(protected, ProtectedRecord{Name: name, Type: recordType})
+	}
+	return protected, nil
+}
+
+// Match reports whether a record with the given name and type in zone is protected
+func (p ProtectedRecords) Match(zone, dnsName, recordType string) bool {
+	dnsName = strings.ToLower(strings.TrimSuffix(dnsName, "."))
+	zone = strings.ToLower(zone)
+
+	relative := "@"
+	if dnsName != zone {
+		relative = strings.TrimSuffix(dnsName, "."+zone)
+	}
+
+	for _, rule := range p {
+		if rule.Type != "" && rule.Type != "*" && !strings.EqualFold(rule.Type, recordType) {
+			continue
+		}
+		if ok, _ := path.Match(rule.Name, dnsName); ok {
+			return true
+		}
+		if ok, _ := path.Match(rule.Name, relative); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isProtected reports whether a record name and type is protected, resolving its zone
+func (h *Handler) isProtected(p *Policy, dnsName, recordType string) bool {
+	if len(p.Protected) == 0 {
+		return false
+	}
+	zone, err := h.extractDomain(dnsName)
+	if err != nil {
+		return false
+	}
+	return p.Protected.Match(zone, dnsName, recordType)
+}
+
+// filterProtected removes every change touching a protected record from the
+// batch, logging each refused change
+func (h *Handler) filterProtected(p *Policy, changes *Changes) *Changes {
+	if len(p.Protected) == 0 {
+		return changes
+	}
+
+	filtered := &Changes{}
+
+	for _, ep := range changes.Create {
+		if h.isProtected(p, ep.DNSName, ep.RecordType) {
+			h.Logger.Warn("Refusing to create protected record", "dnsName", ep.DNSName, "recordType", ep.RecordType)
+			protectedChangesSkipped.Inc("create")
+			continue
+		}
+		filtered.Create = append(filtered.Create, ep)
+	}
+
+	for i, newEp := range changes.UpdateNew {
+		oldEp := changes.UpdateOld[i]
+		if h.isProtected(p, oldEp.DNSName, oldEp.RecordType) || h.isProtected(p, newEp.DNSName, newEp.RecordType) {
+			h.Logger.Warn("Refusing to update protected record", "dnsName", newEp.DNSName, "recordType", newEp.RecordType)
+			protectedChangesSkipped.Inc("update")
+			continue
+		}
+		filtered.UpdateOld = append(filtered.UpdateOld, oldEp)
+		filtered.UpdateNew = append(filtered.UpdateNew, newEp)
+	}
+
+	for _, ep := range changes.Delete {
+		if h.isProtected(p, ep.DNSName, ep.RecordType) {
+			h.Logger.Warn("Refusing to delete protected record", "dnsName", ep.DNSName, "recordType", ep.RecordType)
+			protectedChangesSkipped.Inc("delete")
+			continue
+		}
+		filtered.Delete = append(filtered.Delete, ep)
+	}
+
+	return filtered
+}
@@ -0,0 +1,73 @@
+package webhook
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseProtectedRecords(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    ProtectedRecords
+		wantErr bool
+	}{
+		{name: "empty", input: ""},
+		{
+			name:  "names and types",
+			input: " @:mx, _dmarc:TXT,WWW.Example.com.:cname,*._domainkey ",
+			want: ProtectedRecords{
+				{Name: "@", Type: "MX"},
+				{Name: "_dmarc", Type: "TXT"},
+				{Name: "www.example.com", Type: "CNAME"},
+				{Name: "*._domainkey"},
+			},
+		},
+		{name: "missing name", input: ":TXT", wantErr: true},
+		{name: "invalid pattern", input: "[www", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseProtectedRecords(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseProtectedRecords() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseProtectedRecords() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProtectedRecordsMatch(t *testing.T) {
+	protected, err := ParseProtectedRecords("@:MX,_dmarc:TXT,www.example.com:CNAME,*._domainkey,vpn:*")
+	if err != nil {
+		t.Fatalf("ParseProtectedRecords() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		dnsName    string
+		recordType string
+		want       bool
+	}{
+		{name: "apex by type", dnsName: "example.com", recordType: "MX", want: true},
+		{name: "apex other type", dnsName: "example.com", recordType: "A", want: false},
+		{name: "relative name", dnsName: "_dmarc.example.com", recordType: "TXT", want: true},
+		{name: "relative name wrong type", dnsName: "_dmarc.example.com", recordType: "CNAME", want: false},
+		{name: "fully qualified name", dnsName: "www.example.com", recordType: "CNAME", want: true},
+		{name: "fully qualified name with trailing dot and case", dnsName: "WWW.example.com.", recordType: "cname", want: true},
+		{name: "glob without type", dnsName: "s1._domainkey.example.com", recordType: "TXT", want: true},
+		{name: "wildcard type", dnsName: "vpn.example.com", recordType: "AAAA", want: true},
+		{name: "unprotected", dnsName: "api.example.com", recordType: "A", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := protected.Match("example.com", tt.dnsName, tt.recordType); got != tt.want {
+				t.Errorf("Match(%q, %q) = %v, want %v", tt.dnsName, tt.recordType, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package webhook
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SafetyLimits are guardrails checked before an ApplyChanges batch touches
+// Simply.com. A zero value for a limit disables it.
+type SafetyLimits struct {
+	// MaxDeletes is the maximum number of records deleted in one batch
+	MaxDeletes int
+	// MaxDeletePercent is the maximum share of a zone's records (0-100)
+	// deleted in one batch
+	MaxDeletePercent float64
+	// MaxChanges is the maximum number of creates, updates and deletes in one batch
+	MaxChanges int
+	// Override applies batches that exceed the limits, logging a warning instead
+	Override bool
+}
+
+// SafetyLimitError is returned when a batch exceeds one of the SafetyLimits
+type SafetyLimitError struct {
+	Reason     string
+	Violations []string
+}
+
+func (e *SafetyLimitError) Error() string {
+	return fmt.Sprintf("batch rejected by safety limits: %s", strings.Join(e.Violations, "; "))
+}
+
+// check validates a batch of totalChanges planned changes against the limits.
+// deletesPerZone counts the records the batch would delete in each zone and
+// zoneSizes the number of records currently in each zone.
+func (l SafetyLimits) check(totalChanges int, deletesPerZone, zoneSizes map[string]int) *SafetyLimitError {
+	var violations []string
+	reason := ""
+
+	totalDeletes := 0
+	for _, n := range deletesPerZone {
+		totalDeletes += n
+	}
+
+	if l.MaxChanges > 0 && totalChanges > l.MaxChanges {
+		violations = append(violations, fmt.Sprintf("%d changes exceeds the maximum of %d", totalChanges, l.MaxChanges))
+		reason = "max_changes"
+	}
+
+	if l.MaxDeletes > 0 && totalDeletes > l.MaxDeletes {
+		violations = append(violations, fmt.Sprintf("%d deletes exceeds the maximum of %d", totalDeletes, l.MaxDeletes))
+		reason = "max_deletes"
+	}
+
+	if l.MaxDeletePercent > 0 {
+		zones := make([]string, 0, len(deletesPerZone))
+		for zone := range deletesPerZone {
+			zones = append(zones, zone)
+		}
+		sort.Strings(zones)
+
+		for _, zone := range zones {
+			size := zoneSizes[zone]
+			if size == 0 {
+				continue
+			}
+			percent := float64(deletesPerZone[zone]) * 100 / float64(size)
+			if percent > l.MaxDeletePercent {
+				violations = append(violations, fmt.Sprintf("deleting %d of %d records (%.1f%%) in zone %s exceeds the maximum of %.1f%%",
+					deletesPerZone[zone], size, percent, zone, l.MaxDeletePercent))
+				reason = "max_delete_percent"
+			}
+		}
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+	return &SafetyLimitError{Reason: reason, Violations: violations}
+}
@@ -0,0 +1,86 @@
+package webhook
+
+import "testing"
+
+func TestSafetyLimitsCheck(t *testing.T) {
+	zoneSizes := map[string]int{"example.com": 10, "example.org": 100}
+
+	tests := []struct {
+		name           string
+		limits         SafetyLimits
+		totalChanges   int
+		deletesPerZone map[string]int
+		wantReason     string
+		wantViolations int
+	}{
+		{
+			name:           "no limits",
+			totalChanges:   500,
+			deletesPerZone: map[string]int{"example.com": 10},
+		},
+		{
+			name:           "within limits",
+			limits:         SafetyLimits{MaxChanges: 10, MaxDeletes: 5, MaxDeletePercent: 50},
+			totalChanges:   10,
+			deletesPerZone: map[string]int{"example.com": 5},
+		},
+		{
+			name:           "too many changes",
+			limits:         SafetyLimits{MaxChanges: 10},
+			totalChanges:   11,
+			wantReason:     "max_changes",
+			wantViolations: 1,
+		},
+		{
+			name:           "too many deletes across zones",
+			limits:         SafetyLimits{MaxDeletes: 5},
+			totalChanges:   6,
+			deletesPerZone: map[string]int{"example.com": 3, "example.org": 3},
+			wantReason:     "max_deletes",
+			wantViolations: 1,
+		},
+		{
+			name:           "delete percent per zone",
+			limits:         SafetyLimits{MaxDeletePercent: 20},
+			totalChanges:   23,
+			deletesPerZone: map[string]int{"example.com": 3, "example.org": 20},
+			wantReason:     "max_delete_percent",
+			wantViolations: 1,
+		},
+		{
+			name:           "unknown zone size is skipped",
+			limits:         SafetyLimits{MaxDeletePercent: 20},
+			totalChanges:   5,
+			deletesPerZone: map[string]int{"example.net": 5},
+		},
+		{
+			name:           "every violation is reported",
+			limits:         SafetyLimits{MaxChanges: 5, MaxDeletes: 5, MaxDeletePercent: 50},
+			totalChanges:   8,
+			deletesPerZone: map[string]int{"example.com": 8},
+			wantReason:     "max_delete_percent",
+			wantViolations: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.limits.check(tt.totalChanges, tt.deletesPerZone, zoneSizes)
+			if tt.wantViolations == 0 {
+				if err != nil {
+					t.Fatalf("check() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("check() = nil, want %s", tt.wantReason)
+			}
+			if err.Reason != tt.wantReason {
+				t.Errorf("Reason = %q, want %q", err.Reason, tt.wantReason)
+			}
+			if len(err.Violations) != tt.wantViolations {
+				t.Errorf("Violations = %q, want %d", err.Violations, tt.wantViolations)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package webhook
+
+import (
+	"strings"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
+)
+
+// TTLPolicy decides the TTL of records. Endpoints without a TTL get the most
+// specific default that applies, and every TTL is clamped to the allowed range.
+type TTLPolicy struct {
+	// Default applies to endpoints without a TTL when no more specific
+	// default is configured
+	Default int
+	// Types holds default TTLs per record type, e.g. "TXT"
+	Types map[string]int
+	// Domains holds default TTLs per zone, taking precedence over the above
+	Domains map[string]DomainTTL
+
+	// Min and Max bound every TTL; zero disables a bound. TTLs are never
+	// lower than simply.MinTTL.
+	Min int
+	Max int
+}
+
+// DomainTTL holds the default TTLs of one zone
+type DomainTTL struct {
+	// Default applies to endpoints in the zone without a TTL
+	Default int
+	// Types holds default TTLs per record type in the zone
+	Types map[string]int
+}
+
+// Resolve returns the TTL to use for a record of the given type in zone. A
+// ttl of zero is replaced by the applicable default; the result is clamped
+// to the allowed range.
+func (t TTLPolicy) Resolve(zone, recordType string, ttl int) int {
+	if ttl <= 0 {
+		ttl = t.defaultTTL(strings.ToLower(zone), strings.ToUpper(recordType))
+	}
+	return t.clamp(ttl)
+}
+
+// defaultTTL returns the most specific default for a record type in zone,
+// checking the zone's per-type and zone-wide defaults before the global ones
+func (t TTLPolicy) defaultTTL(zone, recordType string) int {
+	if d, ok := t.Domains[zone]; ok {
+		if ttl := d.Types[recordType]; ttl > 0 {
+			return ttl
+		}
+		if d.Default > 0 {
+			return d.Default
+		}
+	}
+	if ttl := t.Types[recordType]; ttl > 0 {
+		return ttl
+	}
+	if t.Default > 0 {
+		return t.Default
+	}
+	return DefaultTTL
+}
+
+// clamp bounds a TTL to the configured range and Simply.com's minimum
+func (t TTLPolicy) clamp(ttl int) int {
+	lower := t.Min
+	if lower < simply.MinTTL {
+		lower = simply.MinTTL
+	}
+	if t.Max > 0 && ttl > t.Max {
+		ttl = t.Max
+	}
+	if ttl < lower {
+		ttl = lower
+	}
+	return ttl
+}
@@ -0,0 +1,45 @@
+package webhook
+
+import "testing"
+
+func TestTTLPolicyResolve(t *testing.T) {
+	policy := TTLPolicy{
+		Default: 600,
+		Types:   map[string]int{"TXT": 300},
+		Domains: map[string]DomainTTL{
+			"example.com": {Default: 1800, Types: map[string]int{"MX": 7200}},
+			"example.org": {Types: map[string]int{"A": 120}},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		policy     TTLPolicy
+		zone       string
+		recordType string
+		ttl        int
+		want       int
+	}{
+		{name: "explicit TTL is kept", policy: policy, zone: "example.com", recordType: "A", ttl: 900, want: 900},
+		{name: "global default", policy: policy, zone: "example.net", recordType: "A", want: 600},
+		{name: "type default", policy: policy, zone: "example.net", recordType: "txt", want: 300},
+		{name: "zone default before type default", policy: policy, zone: "example.com", recordType: "TXT", want: 1800},
+		{name: "zone type default", policy: policy, zone: "Example.COM", recordType: "MX", want: 7200},
+		{name: "zone without default falls back to type default", policy: policy, zone: "example.org", recordType: "TXT", want: 300},
+		{name: "zone type default without zone default", policy: policy, zone: "example.org", recordType: "A", want: 120},
+		{name: "built-in default", zone: "example.com", recordType: "A", want: DefaultTTL},
+		{name: "raised to minimum", policy: TTLPolicy{Min: 300}, zone: "example.com", recordType: "A", ttl: 120, want: 300},
+		{name: "lowered to maximum", policy: TTLPolicy{Max: 3600}, zone: "example.com", recordType: "A", ttl: 86400, want: 3600},
+		{name: "default is clamped too", policy: TTLPolicy{Default: 7200, Max: 3600}, zone: "example.com", recordType: "A", want: 3600},
+		{name: "never below the Simply.com minimum", zone: "example.com", recordType: "A", ttl: 30, want: 60},
+		{name: "minimum below the Simply.com minimum", policy: TTLPolicy{Min: 10}, zone: "example.com", recordType: "A", ttl: 30, want: 60},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Resolve(tt.zone, tt.recordType, tt.ttl); got != tt.want {
+				t.Errorf("Resolve(%q, %q, %d) = %d, want %d", tt.zone, tt.recordType, tt.ttl, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package webhook
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// DefaultZoneLockTimeout is how long ApplyChanges waits for the zones it
+// touches to be released by other batches
+const DefaultZoneLockTimeout = 30 * time.Second
+
+// zoneLocks serializes mutations per zone. Each zone is guarded by a channel
+// with a buffer of one, so acquiring it can be abandoned on timeout.
+type zoneLocks struct {
+	mu    sync.Mutex
+	locks map[string]chan struct{}
+}
+
+func (z *zoneLocks) get(zone string) chan struct{} {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if z.locks == nil {
+		z.locks = make(map[string]chan struct{})
+	}
+	lock, ok := z.locks[zone]
+	if !ok {
+		lock = make(chan struct{}, 1)
+		z.locks[zone] = lock
+	}
+	return lock
+}
+
+// lock acquires the locks of all zones in sorted order, so two batches
+// touching overlapping zones cannot deadlock. On failure every lock acquired
+// so far is released and the context error is returned.
+func (z *zoneLocks) lock(ctx context.Context, zones []string) (unlock func(), err error) {
+	sorted := append([]string{}, zones...)
+	sort.Strings(sorted)
+
+	var held []chan struct{}
+	release := func() {
+		for i := len(held) - 1; i >= 0; i-- {
+			<-held[i]
+		}
+	}
+
+	for _, zone := range sorted {
+		lock := z.get(zone)
+		select {
+		case lock <- struct{}{}:
+			held = append(held, lock)
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		}
+	}
+	return release, nil
+}
+
+// LockZone acquires the lock ApplyChanges holds while changing zone, waiting
+// at most ZoneLockTimeout, so readers such as the drift detector never see a
+// batch half applied. The returned function releases the lock.
+func (h *Handler) LockZone(ctx context.Context, zone string) (func(), error) {
+	timeout := h.ZoneLockTimeout
+	if timeout <= 0 {
+		timeout = DefaultZoneLockTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return h.zoneLocks.lock(ctx, []string{canonicalName(zone)})
+}
+
+// batchZones returns the distinct zones touched by a batch
+func (h *Handler) batchZones(changes *Changes) []string {
+	seen := make(map[string]bool)
+	var zones []string
+	for _, eps := range [][]*endpoint.Endpoint{changes.Create, changes.UpdateOld, changes.UpdateNew, changes.Delete} {
+		for _, ep := range eps {
+			zone, err := h.extractDomain(ep.DNSName)
+			if err != nil || seen[zone] {
+				continue
+			}
+			seen[zone] = true
+			zones = append(zones, zone)
+		}
+	}
+	sort.Strings(zones)
+	return zones
+}
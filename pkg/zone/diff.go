@@ -0,0 +1,202 @@
+package zone
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
+)
+
+// Plan is the list of mutations turning the current records of a zone into
+// the desired ones, in the order creates, updates, deletes. Deletes that
+// would conflict with a create at the same name (a CNAME replacing other
+// records or the other way round) come first, as Simply.com rejects a CNAME
+// next to any other record.
+type Plan []simply.Mutation
+
+// Counts returns the number of creates, updates and deletes in the plan
+func (p Plan) Counts() (creates, updates, deletes int) {
+	for _, m := range p {
+		switch m.Action {
+		case simply.ActionCreate:
+			creates++
+		case simply.ActionUpdate:
+			updates++
+		case simply.ActionDelete:
+			deletes++
+		}
+	}
+	return creates, updates, deletes
+}
+
+// Options tune how Diff compares records
+type Options struct {
+	// NoDelete keeps current records that are not desired
+	NoDelete bool
+	// Skip excludes matching current and desired records from the comparison
+	Skip func(simply.Record) bool
+}
+
+// RelativeName returns the canonical zone-relative form of a record name:
+// lowercase, without trailing dot or zone suffix, "@" for the apex
+func RelativeName(name, domain string) string {
+	name = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	switch {
+	case name == "" || name == "@" || name == domain:
+		return "@"
+	case strings.HasSuffix(name, "."+domain):
+		return strings.TrimSuffix(name, "."+domain)
+	default:
+		return name
+	}
+}
+
+type setKey struct {
+	name, recordType string
+}
+
+// Diff computes the mutations turning current into desired for domain.
+// Records are matched by name, type and data; a TTL difference becomes an
+// update. Unmatched records of the same name and type are paired into updates,
+// the rest become creates and deletes. SOA records are never touched.
+func Diff(domain string, current, desired []simply.Record, opts Options) Plan {
+	skip := func(r simply.Record) bool {
+		if strings.EqualFold(r.Type, "SOA") {
+			return true
+		}
+		return opts.Skip != nil && opts.Skip(r)
+	}
+
+	group := func(records []simply.Record) (map[setKey][]simply.Record, []setKey) {
+		sets := make(map[setKey][]simply.Record)
+		var keys []setKey
+		for _, r := range records {
+			if skip(r) {
+				continue
+			}
+			r.Name = RelativeName(r.Name, domain)
+			r.Type = strings.ToUpper(r.Type)
+			k := setKey{r.Name, r.Type}
+			if _, ok := sets[k]; !ok {
+				keys = append(keys, k)
+			}
+			sets[k] = append(sets[k], r)
+		}
+		return sets, keys
+	}
+
+	currentSets, currentKeys := group(current)
+	desiredSets, desiredKeys := group(desired)
+
+	allKeys := append(append([]setKey{}, desiredKeys...), currentKeys...)
+	sort.Slice(allKeys, func(i, j int) bool {
+		if allKeys[i].name != allKeys[j].name {
+			return allKeys[i].name < allKeys[j].name
+		}
+		return allKeys[i].recordType < allKeys[j].recordType
+	})
+
+	var creates, updates, deletes Plan
+	seen := make(map[setKey]bool)
+	for _, k := range allKeys {
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+
+		var unmatchedCurrent []simply.Record
+		remaining := append([]simply.Record{}, desiredSets[k]...)
+		for _, cur := range currentSets[k] {
+			idx := -1
+			for i, want := range remaining {
+				if want.Data == cur.Data && want.Priority == cur.Priority {
+					idx = i
+					break
+				}
+			}
+			if idx < 0 {
+				unmatchedCurrent = append(unmatchedCurrent, cur)
+				continue
+			}
+
+			want := remaining[idx]
+			remaining = append(remaining[:idx], remaining[idx+1:]...)
+			if want.TTL != 0 && want.TTL != cur.TTL {
+				updates = append(updates, update(domain, cur, want))
+			}
+		}
+
+		// Pair leftovers of the same name and type into updates
+		for len(unmatchedCurrent) > 0 && len(remaining) > 0 {
+			updates = append(updates, update(domain, unmatchedCurrent[0], remaining[0]))
+			unmatchedCurrent, remaining = unmatchedCurrent[1:], remaining[1:]
+		}
+
+		for _, want := range remaining {
+			want.ID = 0
+			creates = append(creates, simply.Mutation{Action: simply.ActionCreate, Domain: domain, Record: want})
+		}
+		if !opts.NoDelete {
+			for _, cur := range unmatchedCurrent {
+				before := cur
+				deletes = append(deletes, simply.Mutation{Action: simply.ActionDelete, Domain: domain, Record: cur, Before: &before})
+			}
+		}
+	}
+
+	// Deletes clearing the way for a create go first
+	created := make(map[string][]string)
+	for _, m := range creates {
+		created[m.Record.Name] = append(created[m.Record.Name], m.Record.Type)
+	}
+	var plan, later Plan
+	for _, m := range deletes {
+		if conflicts(m.Record.Type, created[m.Record.Name]) {
+			plan = append(plan, m)
+		} else {
+			later = append(later, m)
+		}
+	}
+	plan = append(plan, creates...)
+	plan = append(plan, updates...)
+	return append(plan, later...)
+}
+
+// conflicts reports whether a record of recordType cannot coexist with
+// records of the given types at the same name: a CNAME excludes every other
+// type
+func conflicts(recordType string, types []string) bool {
+	for _, t := range types {
+		if t != recordType && (t == "CNAME" || recordType == "CNAME") {
+			return true
+		}
+	}
+	return false
+}
+
+// update builds the mutation replacing cur with want, keeping cur's record ID
+func update(domain string, cur, want simply.Record) simply.Mutation {
+	before := cur
+	want.ID = cur.ID
+	if want.TTL == 0 {
+		want.TTL = cur.TTL
+	}
+	return simply.Mutation{Action: simply.ActionUpdate, Domain: domain, Record: want, Before: &before}
+}
+
+// Apply sends every mutation of the plan to Simply.com in order, stopping at
+// the first failure. It returns the number of mutations applied. If done is
+// not nil, it is called with the result of every mutation sent.
+func Apply(client *simply.Client, plan Plan, done func(simply.Mutation, error)) (int, error) {
+	for i, m := range plan {
+		err := client.Apply(m)
+		if done != nil {
+			done(m, err)
+		}
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(plan), nil
+}
@@ -0,0 +1,155 @@
+package zone
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
+)
+
+func TestRelativeName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"", "@"},
+		{"@", "@"},
+		{"example.com", "@"},
+		{"Example.COM.", "@"},
+		{"www.example.com", "www"},
+		{"WWW.Example.com.", "www"},
+		{"www", "www"},
+		{"www.example.org", "www.example.org"},
+	}
+
+	for _, tt := range tests {
+		if got := RelativeName(tt.name, "example.com"); got != tt.want {
+			t.Errorf("RelativeName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	record := func(id int, name, recordType, data string, ttl int) simply.Record {
+		return simply.Record{ID: id, Name: name, Type: recordType, Data: data, TTL: ttl}
+	}
+	soa := record(9, "@", "SOA", "ns1.example.com. hostmaster.example.com. 1 7200 3600 1209600 3600", 3600)
+
+	tests := []struct {
+		name    string
+		current []simply.Record
+		desired []simply.Record
+		opts    Options
+		want    []string
+	}{
+		{
+			name:    "in sync",
+			current: []simply.Record{record(1, "www.example.com", "A", "192.0.2.1", 3600), soa},
+			desired: []simply.Record{record(0, "www", "a", "192.0.2.1", 3600)},
+		},
+		{
+			name:    "desired TTL of zero keeps the current TTL",
+			current: []simply.Record{record(1, "www", "A", "192.0.2.1", 3600)},
+			desired: []simply.Record{record(0, "www", "A", "192.0.2.1", 0)},
+		},
+		{
+			name:    "TTL changed",
+			current: []simply.Record{record(1, "www", "A", "192.0.2.1", 3600)},
+			desired: []simply.Record{record(0, "www", "A", "192.0.2.1", 300)},
+			want:    []string{"update 1 www A 192.0.2.1 300"},
+		},
+		{
+			name:    "data changed in a set is paired into an update",
+			current: []simply.Record{record(1, "www", "A", "192.0.2.1", 3600), record(2, "www", "A", "192.0.2.2", 3600)},
+			desired: []simply.Record{record(0, "www", "A", "192.0.2.1", 3600), record(0, "www", "A", "192.0.2.3", 0)},
+			want:    []string{"update 2 www A 192.0.2.3 3600"},
+		},
+		{
+			name:    "creates, updates and deletes in order",
+			current: []simply.Record{record(1, "old", "A", "192.0.2.1", 3600), record(2, "www", "A", "192.0.2.1", 3600)},
+			desired: []simply.Record{record(7, "new", "A", "192.0.2.9", 3600), record(0, "www", "A", "192.0.2.1", 60)},
+			want: []string{
+				"create 0 new A 192.0.2.9 3600",
+				"update 2 www A 192.0.2.1 60",
+				"delete 1 old A 192.0.2.1 3600",
+			},
+		},
+		{
+			name:    "CNAME replacing an A record is created after the delete",
+			current: []simply.Record{record(1, "www", "A", "192.0.2.1", 3600), record(2, "old", "A", "192.0.2.2", 3600)},
+			desired: []simply.Record{record(0, "www", "CNAME", "example.net", 3600), record(0, "new", "A", "192.0.2.3", 3600)},
+			want: []string{
+				"delete 1 www A 192.0.2.1 3600",
+				"create 0 new A 192.0.2.3 3600",
+				"create 0 www CNAME example.net 3600",
+				"delete 2 old A 192.0.2.2 3600",
+			},
+		},
+		{
+			name:    "A records replacing a CNAME are created after the delete",
+			current: []simply.Record{record(1, "www", "CNAME", "example.net", 3600)},
+			desired: []simply.Record{record(0, "www", "A", "192.0.2.1", 3600), record(0, "www", "A", "192.0.2.2", 3600)},
+			want: []string{
+				"delete 1 www CNAME example.net 3600",
+				"create 0 www A 192.0.2.1 3600",
+				"create 0 www A 192.0.2.2 3600",
+			},
+		},
+		{
+			name:    "no delete",
+			current: []simply.Record{record(1, "old", "A", "192.0.2.1", 3600)},
+			opts:    Options{NoDelete: true},
+		},
+		{
+			name:    "priority is part of the match",
+			current: []simply.Record{{ID: 1, Name: "@", Type: "MX", Data: "mail.example.com", Priority: 10, TTL: 3600}},
+			desired: []simply.Record{{Name: "@", Type: "MX", Data: "mail.example.com", Priority: 20, TTL: 3600}},
+			want:    []string{"update 1 @ MX mail.example.com 3600"},
+		},
+		{
+			name:    "SOA records are never touched",
+			current: []simply.Record{soa},
+			desired: []simply.Record{record(0, "@", "SOA", "other", 60)},
+		},
+		{
+			name:    "skipped records",
+			current: []simply.Record{record(1, "@", "NS", "ns1.simply.com", 3600)},
+			desired: []simply.Record{record(0, "@", "NS", "ns1.example.net", 3600)},
+			opts: Options{Skip: func(r simply.Record) bool {
+				return strings.EqualFold(r.Type, "NS")
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := Diff("example.com", tt.current, tt.desired, tt.opts)
+
+			var got []string
+			for _, m := range plan {
+				got = append(got, fmt.Sprintf("%s %d %s %s %s %d", m.Action, m.Record.ID, m.Record.Name, m.Record.Type, m.Record.Data, m.Record.TTL))
+				if m.Action != simply.ActionCreate && (m.Before == nil || m.Before.ID != m.Record.ID) {
+					t.Errorf("%s of record %d has Before %+v", m.Action, m.Record.ID, m.Before)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanCounts(t *testing.T) {
+	plan := Plan{
+		{Action: simply.ActionCreate},
+		{Action: simply.ActionCreate},
+		{Action: simply.ActionUpdate},
+		{Action: simply.ActionDelete},
+	}
+	creates, updates, deletes := plan.Counts()
+	if creates != 2 || updates != 1 || deletes != 1 {
+		t.Errorf("Counts() = %d, %d, %d, want 2, 1, 1", creates, updates, deletes)
+	}
+}
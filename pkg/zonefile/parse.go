@@ -0,0 +1,319 @@
+package zonefile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/zone"
+)
+
+// token is a single field of a zone file entry
+type token struct {
+	text   string
+	quoted bool
+}
+
+// entry is a logical zone file line, with parentheses already joined
+type entry struct {
+	line   int
+	tokens []token
+	// inherit is set when the entry starts with whitespace and reuses the
+	// previous owner name
+	inherit bool
+}
+
+// Parse reads an RFC 1035 zone file for domain and returns its records in
+// Simply.com form: zone-relative names ("@" for the apex), hostname targets
+// without trailing dot and MX/SRV priorities split out. $ORIGIN and $TTL are
+// supported, TTLs also in BIND unit form such as 1h or 1d; $INCLUDE and
+// $GENERATE are not.
+func Parse(r io.Reader, domain string) ([]simply.Record, error) {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	entries, err := tokenize(r)
+	if err != nil {
+		return nil, err
+	}
+
+	origin := domain
+	defaultTTL := DefaultTTL
+	owner := ""
+	var records []simply.Record
+
+	for _, e := range entries {
+		tokens := e.tokens
+
+		switch strings.ToUpper(tokens[0].text) {
+		case "$ORIGIN":
+			if len(tokens) != 2 {
+				return nil, fmt.Errorf("line %d: $ORIGIN takes one argument", e.line)
+			}
+			origin = absolute(tokens[1].text, origin)
+			continue
+		case "$TTL":
+			if len(tokens) != 2 {
+				return nil, fmt.Errorf("line %d: $TTL takes one argument", e.line)
+			}
+			ttl, err := parseTTL(tokens[1].text)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid $TTL %q", e.line, tokens[1].text)
+			}
+			defaultTTL = ttl
+			continue
+		case "$INCLUDE", "$GENERATE":
+			return nil, fmt.Errorf("line %d: %s is not supported", e.line, tokens[0].text)
+		}
+
+		if !e.inherit {
+			owner = absolute(tokens[0].text, origin)
+			tokens = tokens[1:]
+		} else if owner == "" {
+			return nil, fmt.Errorf("line %d: record without owner name", e.line)
+		}
+
+		if owner != domain && !strings.HasSuffix(owner, "."+domain) {
+			return nil, fmt.Errorf("line %d: %s is outside of zone %s", e.line, owner, domain)
+		}
+
+		// TTL and class may appear in either order before the type
+		ttl := defaultTTL
+		for len(tokens) > 0 {
+			if n, err := parseTTL(tokens[0].text); err == nil {
+				ttl = n
+			} else if class := strings.ToUpper(tokens[0].text); class != "IN" && class != "CH" && class != "HS" {
+				break
+			}
+			tokens = tokens[1:]
+		}
+		if len(tokens) < 2 {
+			return nil, fmt.Errorf("line %d: missing record type or data", e.line)
+		}
+
+		record, err := parseData(strings.ToUpper(tokens[0].text), tokens[1:], origin)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", e.line, err)
+		}
+		record.Name = zone.RelativeName(owner, domain)
+		record.TTL = ttl
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// parseData converts the rdata of a record into Simply.com form
+func parseData(recordType string, rdata []token, origin string) (simply.Record, error) {
+	record := simply.Record{Type: recordType}
+	texts := make([]string, len(rdata))
+	for i, t := range rdata {
+		texts[i] = t.text
+	}
+
+	switch recordType {
+	case "MX":
+		if len(texts) != 2 {
+			return record, fmt.Errorf("MX expects priority and exchange, got %q", strings.Join(texts, " "))
+		}
+		priority, err := strconv.Atoi(texts[0])
+		if err != nil {
+			return record, fmt.Errorf("invalid MX priority %q", texts[0])
+		}
+		record.Priority = priority
+		record.Data = absolute(texts[1], origin)
+
+	case "SRV":
+		if len(texts) != 4 {
+			return record, fmt.Errorf("SRV expects priority, weight, port and target, got %q", strings.Join(texts, " "))
+		}
+		priority, err := strconv.Atoi(texts[0])
+		if err != nil {
+			return record, fmt.Errorf("invalid SRV priority %q", texts[0])
+		}
+		record.Priority = priority
+		record.Data = fmt.Sprintf("%s %s %s", texts[1], texts[2], absolute(texts[3], origin))
+
+	case "TXT", "SPF":
+		// Multiple character-strings form a single value
+		record.Data = strings.Join(texts, "")
+
+	case "CAA":
+		if len(texts) != 3 {
+			return record, fmt.Errorf("CAA expects flags, tag and value, got %q", strings.Join(texts, " "))
+		}
+		// Keep the value quoted or bare as written, matching how Write renders it
+		value := texts[2]
+		if rdata[2].quoted {
+			value = quote(value)
+		}
+		record.Data = fmt.Sprintf("%s %s %s", texts[0], texts[1], value)
+
+	default:
+		if hostnameTypes[recordType] {
+			if len(texts) != 1 {
+				return record, fmt.Errorf("%s expects a single name, got %q", recordType, strings.Join(texts, " "))
+			}
+			record.Data = absolute(texts[0], origin)
+		} else {
+			record.Data = strings.Join(texts, " ")
+		}
+	}
+	return record, nil
+}
+
+// ttlUnits are the BIND TTL unit suffixes in seconds
+var ttlUnits = map[byte]int{'s': 1, 'm': 60, 'h': 3600, 'd': 86400, 'w': 604800}
+
+// parseTTL parses a TTL in seconds or in BIND unit form, e.g. "1h" or "1h30m"
+func parseTTL(s string) (int, error) {
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 {
+		return n, nil
+	}
+	if s == "" || !isDigit(s[0]) {
+		return 0, fmt.Errorf("invalid TTL %q", s)
+	}
+	total, n := 0, 0
+	digits := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isDigit(c) {
+			n = n*10 + int(c-'0')
+			digits = true
+			continue
+		}
+		unit, ok := ttlUnits[c|0x20]
+		if !ok || !digits {
+			return 0, fmt.Errorf("invalid TTL %q", s)
+		}
+		total += n * unit
+		n, digits = 0, false
+	}
+	if digits {
+		return 0, fmt.Errorf("invalid TTL %q", s)
+	}
+	return total, nil
+}
+
+// absolute resolves a zone file name against origin, returning it lowercase
+// and without trailing dot
+func absolute(name, origin string) string {
+	switch {
+	case name == "@":
+		return origin
+	case strings.HasSuffix(name, "."):
+		return strings.ToLower(strings.TrimSuffix(name, "."))
+	case origin == "":
+		return strings.ToLower(name)
+	default:
+		return strings.ToLower(name + "." + origin)
+	}
+}
+
+// tokenize splits a zone file into entries, handling comments, quoted
+// strings, escapes and parenthesized multi-line entries
+func tokenize(r io.Reader) ([]entry, error) {
+	var entries []entry
+	var current *entry
+	depth := 0
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+
+		if depth == 0 {
+			if current != nil && len(current.tokens) > 0 {
+				entries = append(entries, *current)
+			}
+			current = &entry{line: lineNum, inherit: len(line) > 0 && (line[0] == ' ' || line[0] == '\t')}
+		}
+
+		for i := 0; i < len(line); {
+			c := line[i]
+			switch {
+			case c == ';':
+				i = len(line)
+			case c == ' ' || c == '\t' || c == '\r':
+				i++
+			case c == '(':
+				depth++
+				i++
+			case c == ')':
+				if depth == 0 {
+					return nil, fmt.Errorf("line %d: unbalanced parenthesis", lineNum)
+				}
+				depth--
+				i++
+			case c == '"':
+				text, next, err := readQuoted(line, i+1)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", lineNum, err)
+				}
+				current.tokens = append(current.tokens, token{text: text, quoted: true})
+				i = next
+			default:
+				start := i
+				for i < len(line) && !strings.ContainsRune(" \t\r;()\"", rune(line[i])) {
+					if line[i] == '\\' {
+						i++
+					}
+					i++
+				}
+				if i > len(line) {
+					i = len(line)
+				}
+				current.tokens = append(current.tokens, token{text: line[start:i]})
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read zone file: %w", err)
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("line %d: unclosed parenthesis", lineNum)
+	}
+	if current != nil && len(current.tokens) > 0 {
+		entries = append(entries, *current)
+	}
+	return entries, nil
+}
+
+// readQuoted reads a quoted string starting after the opening quote,
+// resolving \X and \DDD escapes. It returns the text and the index after the
+// closing quote.
+func readQuoted(line string, i int) (string, int, error) {
+	var sb strings.Builder
+	for i < len(line) {
+		c := line[i]
+		switch c {
+		case '"':
+			return sb.String(), i + 1, nil
+		case '\\':
+			if i+3 < len(line) && isDigit(line[i+1]) && isDigit(line[i+2]) && isDigit(line[i+3]) {
+				n, _ := strconv.Atoi(line[i+1 : i+4])
+				if n > 255 {
+					return "", 0, fmt.Errorf("invalid escape \\%s", line[i+1:i+4])
+				}
+				sb.WriteByte(byte(n))
+				i += 4
+				continue
+			}
+			if i+1 >= len(line) {
+				return "", 0, fmt.Errorf("unterminated escape")
+			}
+			sb.WriteByte(line[i+1])
+			i += 2
+		default:
+			sb.WriteByte(c)
+			i++
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated quoted string")
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
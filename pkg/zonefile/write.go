@@ -0,0 +1,154 @@
+package zonefile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/zone"
+)
+
+// DefaultTTL is used for records without a TTL and as the $TTL of exported files
+const DefaultTTL = 3600
+
+// maxStringLength is the maximum length of a single character-string (RFC 1035 3.3)
+const maxStringLength = 255
+
+// hostnameTypes are record types whose data is a domain name
+var hostnameTypes = map[string]bool{
+	"CNAME": true,
+	"NS":    true,
+	"PTR":   true,
+	"ALIAS": true,
+}
+
+// Write writes the records of domain as an RFC 1035 zone file. Names are
+// written relative to the $ORIGIN and hostname targets fully qualified.
+func Write(w io.Writer, domain string, records []simply.Record) error {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+
+	sorted := append([]simply.Record{}, records...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ni, nj := zone.RelativeName(sorted[i].Name, domain), zone.RelativeName(sorted[j].Name, domain)
+		// Keep the apex, and its SOA, first
+		if ni != nj {
+			if ni == "@" || nj == "@" {
+				return ni == "@"
+			}
+			return ni < nj
+		}
+		if sorted[i].Type != sorted[j].Type {
+			if strings.EqualFold(sorted[i].Type, "SOA") || strings.EqualFold(sorted[j].Type, "SOA") {
+				return strings.EqualFold(sorted[i].Type, "SOA")
+			}
+			return sorted[i].Type < sorted[j].Type
+		}
+		return sorted[i].Data < sorted[j].Data
+	})
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "$ORIGIN %s.\n", domain)
+	fmt.Fprintf(bw, "$TTL %d\n", DefaultTTL)
+
+	for _, r := range sorted {
+		ttl := r.TTL
+		if ttl == 0 {
+			ttl = DefaultTTL
+		}
+		recordType := strings.ToUpper(r.Type)
+		rdata, err := formatData(r)
+		if err != nil {
+			return fmt.Errorf("record %s %s: %w", r.Name, recordType, err)
+		}
+		fmt.Fprintf(bw, "%s\t%d\tIN\t%s\t%s\n", zone.RelativeName(r.Name, domain), ttl, recordType, rdata)
+	}
+	return bw.Flush()
+}
+
+// formatData renders the data of a Simply.com record in zone file presentation format
+func formatData(r simply.Record) (string, error) {
+	recordType := strings.ToUpper(r.Type)
+	data := strings.TrimSpace(r.Data)
+
+	switch recordType {
+	case "MX":
+		fields := strings.Fields(data)
+		switch len(fields) {
+		case 1:
+			return fmt.Sprintf("%d %s", r.Priority, fqdn(fields[0])), nil
+		case 2:
+			return fmt.Sprintf("%s %s", fields[0], fqdn(fields[1])), nil
+		}
+		return "", fmt.Errorf("invalid MX data %q", data)
+
+	case "SRV":
+		fields := strings.Fields(data)
+		switch len(fields) {
+		case 3:
+			return fmt.Sprintf("%d %s %s %s", r.Priority, fields[0], fields[1], fqdn(fields[2])), nil
+		case 4:
+			return fmt.Sprintf("%s %s %s %s", fields[0], fields[1], fields[2], fqdn(fields[3])), nil
+		}
+		return "", fmt.Errorf("invalid SRV data %q", data)
+
+	case "TXT", "SPF":
+		// Written as stored, quotes included, so Parse restores it byte for byte
+		return quoteTXT(r.Data), nil
+
+	case "CAA":
+		fields := strings.SplitN(data, " ", 3)
+		if len(fields) != 3 {
+			return "", fmt.Errorf("invalid CAA data %q", data)
+		}
+		return fmt.Sprintf("%s %s %s", fields[0], fields[1], caaValue(fields[2])), nil
+	}
+
+	if hostnameTypes[recordType] {
+		return fqdn(data), nil
+	}
+	return data, nil
+}
+
+// fqdn adds the trailing dot of a fully qualified name
+func fqdn(name string) string {
+	if name == "@" || strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// quote renders s as a single quoted character-string
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// quoteTXT renders TXT data as one or more quoted character-strings of at
+// most 255 bytes each
+func quoteTXT(s string) string {
+	if len(s) <= maxStringLength {
+		return quote(s)
+	}
+	var parts []string
+	for len(s) > maxStringLength {
+		parts = append(parts, quote(s[:maxStringLength]))
+		s = s[maxStringLength:]
+	}
+	parts = append(parts, quote(s))
+	return strings.Join(parts, " ")
+}
+
+// caaValue renders a CAA value as stored: quoted values are kept as they
+// are, bare ones only quoted when they could not be read back as one field
+func caaValue(s string) string {
+	if len(s) >= 2 && strings.HasPrefix(s, `"`) && strings.HasSuffix(s, `"`) {
+		return s
+	}
+	if s == "" || strings.ContainsAny(s, " \t;()\"\\") {
+		return quote(s)
+	}
+	return s
+}
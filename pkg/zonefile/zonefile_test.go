@@ -0,0 +1,188 @@
+package zonefile
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []simply.Record
+		wantErr bool
+	}{
+		{
+			name: "origin, ttl and inherited owner",
+			input: `$ORIGIN example.com.
+$TTL 300
+@	IN	A	192.0.2.1
+	IN	MX	10 mail
+www	60	IN	CNAME	@
+mail.example.com.	IN	60	AAAA	2001:db8::1 ; comment
+`,
+			want: []simply.Record{
+				{Name: "@", Type: "A", Data: "192.0.2.1", TTL: 300},
+				{Name: "@", Type: "MX", Data: "mail.example.com", Priority: 10, TTL: 300},
+				{Name: "www", Type: "CNAME", Data: "example.com", TTL: 60},
+				{Name: "mail", Type: "AAAA", Data: "2001:db8::1", TTL: 60},
+			},
+		},
+		{
+			name:  "default origin and ttl",
+			input: "api IN A 192.0.2.2\n",
+			want:  []simply.Record{{Name: "api", Type: "A", Data: "192.0.2.2", TTL: DefaultTTL}},
+		},
+		{
+			name: "multi-line SRV, TXT and CAA",
+			input: `_sip._tcp 3600 IN SRV (
+	10 5 5060 ; priority weight port
+	sip.example.com. )
+@ 3600 IN TXT "v=spf1 " "include:_spf.example.net -all"
+@ 3600 IN TXT "quote \"inside\" and \059"
+@ 3600 IN CAA 0 issue "letsencrypt.org"
+`,
+			want: []simply.Record{
+				{Name: "_sip._tcp", Type: "SRV", Data: "5 5060 sip.example.com", Priority: 10, TTL: 3600},
+				{Name: "@", Type: "TXT", Data: "v=spf1 include:_spf.example.net -all", TTL: 3600},
+				{Name: "@", Type: "TXT", Data: `quote "inside" and ;`, TTL: 3600},
+				{Name: "@", Type: "CAA", Data: `0 issue "letsencrypt.org"`, TTL: 3600},
+			},
+		},
+		{
+			name: "TTL units",
+			input: `$TTL 1d
+@ IN A 192.0.2.1
+www 1h30m IN A 192.0.2.2
+api IN 2W A 192.0.2.3
+`,
+			want: []simply.Record{
+				{Name: "@", Type: "A", Data: "192.0.2.1", TTL: 86400},
+				{Name: "www", Type: "A", Data: "192.0.2.2", TTL: 5400},
+				{Name: "api", Type: "A", Data: "192.0.2.3", TTL: 1209600},
+			},
+		},
+		{
+			name:  "bare CAA value",
+			input: "@ IN CAA 0 iodef mailto:security@example.com\n",
+			want:  []simply.Record{{Name: "@", Type: "CAA", Data: "0 iodef mailto:security@example.com", TTL: DefaultTTL}},
+		},
+		{name: "invalid $TTL", input: "$TTL 1x\n", wantErr: true},
+		{name: "$TTL without number", input: "$TTL h\n", wantErr: true},
+		{name: "outside of zone", input: "www.example.org. IN A 192.0.2.1\n", wantErr: true},
+		{name: "include", input: "$INCLUDE other.zone\n", wantErr: true},
+		{name: "missing data", input: "www IN A\n", wantErr: true},
+		{name: "invalid MX", input: "@ IN MX mail.example.com.\n", wantErr: true},
+		{name: "unclosed parenthesis", input: "@ IN TXT ( \"a\"\n", wantErr: true},
+		{name: "unterminated string", input: "@ IN TXT \"a\n", wantErr: true},
+		{name: "inherited owner without owner", input: "\tIN A 192.0.2.1\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(tt.input), "example.com")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteParseRoundTrip(t *testing.T) {
+	records := []simply.Record{
+		{Name: "@", Type: "A", Data: "192.0.2.1", TTL: 3600},
+		{Name: "@", Type: "MX", Data: "mail.example.com", Priority: 10, TTL: 3600},
+		{Name: "@", Type: "TXT", Data: "v=spf1 -all", TTL: 300},
+		{Name: "@", Type: "TXT", Data: strings.Repeat("k", 300), TTL: 300},
+		{Name: "@", Type: "TXT", Data: `say "hi" \ bye`, TTL: 300},
+		{Name: "@", Type: "CAA", Data: `0 issue "letsencrypt.org"`, TTL: 3600},
+		{Name: "www", Type: "CNAME", Data: "example.net", TTL: 60},
+		{Name: "v6", Type: "AAAA", Data: "2001:db8::1", TTL: 3600},
+		{Name: "_sip._tcp", Type: "SRV", Data: "5 5060 sip.example.com", Priority: 20, TTL: 3600},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, "example.com", records); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	got, err := Parse(&buf, "example.com")
+	if err != nil {
+		t.Fatalf("Parse() error = %v\n%s", err, buf.String())
+	}
+
+	sortRecords(got)
+	want := append([]simply.Record{}, records...)
+	sortRecords(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+// TestWriteParseRoundTripAPIData round trips data shaped like Simply.com's
+// API responses, which may carry quotes, and expects it back unchanged so an
+// export followed by an import plans no updates
+func TestWriteParseRoundTripAPIData(t *testing.T) {
+	records := []simply.Record{
+		{Name: "@", Type: "TXT", Data: `"v=spf1 include:_spf.simply.com -all"`, TTL: 3600},
+		{Name: "_dmarc", Type: "TXT", Data: `"v=DMARC1; p=reject"`, TTL: 3600},
+		{Name: "multi", Type: "TXT", Data: `"part one" "part two"`, TTL: 3600},
+		{Name: "spaces", Type: "TXT", Data: " padded ", TTL: 3600},
+		{Name: "@", Type: "CAA", Data: `0 issue "letsencrypt.org"`, TTL: 3600},
+		{Name: "@", Type: "CAA", Data: "0 issuewild letsencrypt.org", TTL: 3600},
+		{Name: "@", Type: "CAA", Data: `0 iodef "mailto:security@example.com"`, TTL: 3600},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, "example.com", records); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	got, err := Parse(&buf, "example.com")
+	if err != nil {
+		t.Fatalf("Parse() error = %v\n%s", err, buf.String())
+	}
+
+	sortRecords(got)
+	want := append([]simply.Record{}, records...)
+	sortRecords(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestWriteFullyQualifiedNames(t *testing.T) {
+	records := []simply.Record{
+		{Name: "www.example.com", Type: "CNAME", Data: "target.example.net", TTL: 60},
+		{Name: "example.com", Type: "NS", Data: "ns1.simply.com", TTL: 3600},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, "example.com.", records); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	want := "$ORIGIN example.com.\n$TTL 3600\n@\t3600\tIN\tNS\tns1.simply.com.\nwww\t60\tIN\tCNAME\ttarget.example.net.\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Write() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func sortRecords(records []simply.Record) {
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Data < b.Data
+	})
+}
@@ -0,0 +1,125 @@
+package zonesync
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultTTL applies to records without a TTL when the file sets none
+const DefaultTTL = 3600
+
+// Config is the declarative description of records maintained outside ExternalDNS
+type Config struct {
+	// DefaultTTL applies to records without their own TTL
+	DefaultTTL int `yaml:"defaultTTL"`
+	// Domains maps a Simply.com domain to its records
+	Domains map[string]Domain `yaml:"domains"`
+}
+
+// Domain lists the desired records of a single domain
+type Domain struct {
+	// Prune deletes records that are neither declared nor owned by ExternalDNS
+	Prune   bool     `yaml:"prune"`
+	Records []Record `yaml:"records"`
+}
+
+// Record is a single declared record
+type Record struct {
+	// Name is relative to the domain; "@" or empty for the apex
+	Name     string `yaml:"name"`
+	Type     string `yaml:"type"`
+	Data     string `yaml:"data"`
+	TTL      int    `yaml:"ttl"`
+	Priority int    `yaml:"priority"`
+}
+
+// Load reads and validates a sync file. Unknown fields are rejected so typos
+// do not silently drop records.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sync file: %w", err)
+	}
+
+	var config Config
+	if err := yaml.UnmarshalStrict(bytes.TrimSpace(data), &config); err != nil {
+		return nil, fmt.Errorf("failed to parse sync file: %w", err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// Validate checks the configuration for missing or invalid fields
+func (c *Config) Validate() error {
+	if len(c.Domains) == 0 {
+		return fmt.Errorf("sync file declares no domains")
+	}
+	if c.DefaultTTL < 0 {
+		return fmt.Errorf("defaultTTL must not be negative")
+	}
+
+	var problems []string
+	for _, domain := range c.DomainNames() {
+		for i, r := range c.Domains[domain].Records {
+			where := fmt.Sprintf("domains.%s.records[%d]", domain, i)
+			if r.Type == "" {
+				problems = append(problems, where+": type is required")
+			}
+			if r.Data == "" {
+				problems = append(problems, where+": data is required")
+			}
+			if r.TTL < 0 {
+				problems = append(problems, where+": ttl must not be negative")
+			}
+			if r.Priority != 0 && !strings.EqualFold(r.Type, "MX") && !strings.EqualFold(r.Type, "SRV") {
+				problems = append(problems, where+": priority is only valid for MX and SRV records")
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid sync file:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// DomainNames returns the declared domains in sorted order
+func (c *Config) DomainNames() []string {
+	names := make([]string, 0, len(c.Domains))
+	for name := range c.Domains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Records returns the declared records of a domain in Simply.com form
+func (c *Config) Records(domain string) []simply.Record {
+	defaultTTL := c.DefaultTTL
+	if defaultTTL == 0 {
+		defaultTTL = DefaultTTL
+	}
+
+	var records []simply.Record
+	for _, r := range c.Domains[domain].Records {
+		ttl := r.TTL
+		if ttl == 0 {
+			ttl = defaultTTL
+		}
+		records = append(records, simply.Record{
+			Name:     r.Name,
+			Type:     strings.ToUpper(r.Type),
+			Data:     r.Data,
+			TTL:      ttl,
+			Priority: r.Priority,
+		})
+	}
+	return records
+}
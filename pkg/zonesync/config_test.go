@@ -0,0 +1,94 @@
+package zonesync
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
+)
+
+func writeSyncFile(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "records.yaml")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	config, err := Load(writeSyncFile(t, `
+defaultTTL: 600
+domains:
+  example.com:
+    prune: true
+    records:
+      - {name: "@", type: mx, data: mail.example.com, priority: 10}
+      - {name: _dmarc, type: TXT, data: "v=DMARC1; p=reject", ttl: 300}
+  example.org:
+    records: []
+`))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if got := config.DomainNames(); !reflect.DeepEqual(got, []string{"example.com", "example.org"}) {
+		t.Errorf("DomainNames() = %v", got)
+	}
+	want := []simply.Record{
+		{Name: "@", Type: "MX", Data: "mail.example.com", Priority: 10, TTL: 600},
+		{Name: "_dmarc", Type: "TXT", Data: "v=DMARC1; p=reject", TTL: 300},
+	}
+	if got := config.Records("example.com"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Records() = %+v, want %+v", got, want)
+	}
+	if !config.Domains["example.com"].Prune || config.Domains["example.org"].Prune {
+		t.Error("prune not read per domain")
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		wants []string
+	}{
+		{name: "no domains", file: "defaultTTL: 60\n", wants: []string{"declares no domains"}},
+		{name: "unknown field", file: "domains:\n  example.com:\n    record: []\n", wants: []string{"field record not found"}},
+		{
+			name: "every invalid record is reported",
+			file: `
+domains:
+  example.com:
+    records:
+      - {name: www, data: 192.0.2.1}
+      - {name: www, type: A}
+      - {name: www, type: A, data: 192.0.2.1, ttl: -1}
+      - {name: www, type: A, data: 192.0.2.1, priority: 10}
+`,
+			wants: []string{
+				"records[0]: type is required",
+				"records[1]: data is required",
+				"records[2]: ttl must not be negative",
+				"records[3]: priority is only valid for MX and SRV records",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeSyncFile(t, tt.file))
+			if err == nil {
+				t.Fatalf("Load() succeeded, want errors %q", tt.wants)
+			}
+			for _, want := range tt.wants {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Load() error = %v\nwant it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package zonesync
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/webhook"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/zone"
+)
+
+// heritage marks the TXT ownership records of ExternalDNS's TXT registry
+const heritage = "heritage=external-dns"
+
+// registryTypePrefixes are the record type prefixes ExternalDNS's TXT
+// registry adds to the names of its ownership records
+var registryTypePrefixes = []string{"a-", "aaaa-", "cname-", "ns-", "mx-", "srv-", "txt-", "caa-", "ptr-", "naptr-"}
+
+// Ownership tells which records of a zone are managed by ExternalDNS.
+// Ownership is tracked per name and type, so records ExternalDNS does not
+// manage can share a name with those it does, such as an apex MX next to an
+// apex A record.
+type Ownership struct {
+	domain string
+	owned  map[string]bool
+}
+
+// NewOwnership derives ExternalDNS ownership from the live records of a
+// zone: records carrying the webhook's comment, the TXT registry records
+// themselves, and the records named by "<type>-<name>" registry records are
+// all owned by ExternalDNS. Registry records without a type prefix do not
+// say which type they cover, so they only mark themselves as owned.
+func NewOwnership(domain string, records []simply.Record) *Ownership {
+	o := &Ownership{domain: domain, owned: make(map[string]bool)}
+
+	for _, r := range records {
+		name := zone.RelativeName(r.Name, domain)
+		if r.Comment == webhook.DefaultComment {
+			o.owned[ownershipKey(name, r.Type)] = true
+		}
+		if !isRegistryRecord(r) {
+			continue
+		}
+
+		for _, prefix := range registryTypePrefixes {
+			if stripped, ok := strings.CutPrefix(name, prefix); ok {
+				if stripped == "" {
+					stripped = "@"
+				}
+				o.owned[ownershipKey(stripped, strings.TrimSuffix(prefix, "-"))] = true
+			}
+		}
+	}
+	return o
+}
+
+// isRegistryRecord reports whether r is a TXT registry record of ExternalDNS
+func isRegistryRecord(r simply.Record) bool {
+	return strings.EqualFold(r.Type, "TXT") && strings.Contains(r.Data, heritage)
+}
+
+func ownershipKey(name, recordType string) string {
+	return name + ":" + strings.ToUpper(recordType)
+}
+
+// Owns reports whether a record belongs to ExternalDNS
+func (o *Ownership) Owns(r simply.Record) bool {
+	if isRegistryRecord(r) {
+		return true
+	}
+	return o.owned[ownershipKey(zone.RelativeName(r.Name, o.domain), r.Type)]
+}
+
+// DomainPlan is the plan of changes to a single domain
+type DomainPlan struct {
+	Domain string
+	Plan   zone.Plan
+	// Conflicts are declared records skipped because ExternalDNS owns their
+	// name and type
+	Conflicts []simply.Record
+}
+
+// Plan computes the changes needed to make the live zones match the config.
+// Records owned by ExternalDNS are never touched, so both systems can manage
+// the same zone.
+func Plan(client *simply.Client, config *Config) ([]DomainPlan, error) {
+	var plans []DomainPlan
+	for _, domain := range config.DomainNames() {
+		current, err := client.ListRecords(domain)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list records of %s: %w", domain, err)
+		}
+
+		ownership := NewOwnership(domain, current)
+		result := DomainPlan{Domain: domain}
+
+		var desired []simply.Record
+		for _, r := range config.Records(domain) {
+			if ownership.Owns(r) {
+				result.Conflicts = append(result.Conflicts, r)
+				continue
+			}
+			desired = append(desired, r)
+		}
+
+		result.Plan = zone.Diff(domain, current, desired, zone.Options{
+			NoDelete: !config.Domains[domain].Prune,
+			Skip: func(r simply.Record) bool {
+				// Simply.com manages the apex NS records
+				if strings.EqualFold(r.Type, "NS") && zone.RelativeName(r.Name, domain) == "@" {
+					return true
+				}
+				return ownership.Owns(r)
+			},
+		})
+		plans = append(plans, result)
+	}
+	return plans, nil
+}
@@ -0,0 +1,143 @@
+package zonesync
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/uozalp/external-dns-simply-webhook/pkg/simply"
+	"github.com/uozalp/external-dns-simply-webhook/pkg/webhook"
+)
+
+const registryData = `"heritage=external-dns,external-dns/owner=default"`
+
+// liveZone is an apex and www managed by ExternalDNS next to records it does
+// not manage
+var liveZone = []simply.Record{
+	{ID: 1, Name: "@", Type: "A", Data: "192.0.2.1", TTL: 3600, Comment: webhook.DefaultComment},
+	{ID: 2, Name: "a-@", Type: "TXT", Data: registryData, TTL: 3600},
+	{ID: 3, Name: "cname-www", Type: "TXT", Data: registryData, TTL: 3600},
+	{ID: 4, Name: "www", Type: "CNAME", Data: "example.com", TTL: 3600},
+	{ID: 5, Name: "@", Type: "MX", Data: "mail.example.com", Priority: 10, TTL: 3600},
+	{ID: 6, Name: "@", Type: "NS", Data: "ns1.simply.com", TTL: 3600},
+	{ID: 7, Name: "old", Type: "A", Data: "192.0.2.7", TTL: 3600},
+	{ID: 8, Name: "legacy", Type: "TXT", Data: registryData, TTL: 3600},
+}
+
+func TestOwnership(t *testing.T) {
+	o := NewOwnership("example.com", liveZone)
+
+	tests := []struct {
+		record simply.Record
+		want   bool
+	}{
+		{simply.Record{Name: "@", Type: "A"}, true},
+		{simply.Record{Name: "example.com", Type: "a"}, true},
+		{simply.Record{Name: "www", Type: "CNAME"}, true},
+		{simply.Record{Name: "www.example.com.", Type: "CNAME"}, true},
+		{simply.Record{Name: "cname-www", Type: "TXT", Data: registryData}, true},
+		// Other types at an owned name stay free
+		{simply.Record{Name: "@", Type: "MX"}, false},
+		{simply.Record{Name: "www", Type: "TXT", Data: "v=verify"}, false},
+		{simply.Record{Name: "old", Type: "A"}, false},
+		// A registry record without a type prefix only owns itself
+		{simply.Record{Name: "legacy", Type: "A"}, false},
+	}
+	for _, tt := range tests {
+		if got := o.Owns(tt.record); got != tt.want {
+			t.Errorf("Owns(%s %s) = %v, want %v", tt.record.Name, tt.record.Type, got, tt.want)
+		}
+	}
+}
+
+// newTestClient serves records as the live zones of a Simply.com account
+func newTestClient(t *testing.T, zones map[string][]simply.Record) *simply.Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// my/products/{domain}/dns/records
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		records, ok := zones[parts[2]]
+		if !ok {
+			http.Error(w, `{"message":"domain not found"}`, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": 200, "records": records})
+	}))
+	t.Cleanup(server.Close)
+
+	client := simply.NewClient("S123456", "key")
+	client.BaseURL = server.URL + "/"
+	return client
+}
+
+func TestPlan(t *testing.T) {
+	client := newTestClient(t, map[string][]simply.Record{"example.com": liveZone})
+
+	tests := []struct {
+		name          string
+		domain        Domain
+		wantPlan      []string
+		wantConflicts []string
+	}{
+		{
+			name: "declared records next to ExternalDNS",
+			domain: Domain{Records: []Record{
+				{Name: "@", Type: "MX", Data: "mail.example.com", Priority: 20},
+				{Name: "@", Type: "TXT", Data: "v=spf1 -all"},
+				{Name: "www", Type: "CNAME", Data: "other.example.net"},
+			}},
+			wantPlan:      []string{"create @ TXT v=spf1 -all", "update @ MX mail.example.com"},
+			wantConflicts: []string{"www CNAME"},
+		},
+		{
+			name: "prune keeps ExternalDNS records and the apex NS",
+			domain: Domain{Prune: true, Records: []Record{
+				{Name: "@", Type: "MX", Data: "mail.example.com", Priority: 10},
+			}},
+			wantPlan: []string{"delete old A 192.0.2.7"},
+		},
+		{
+			name:   "without prune nothing is deleted",
+			domain: Domain{Records: []Record{{Name: "@", Type: "MX", Data: "mail.example.com", Priority: 10}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Domains: map[string]Domain{"example.com": tt.domain}}
+			plans, err := Plan(client, config)
+			if err != nil {
+				t.Fatalf("Plan() error = %v", err)
+			}
+			if len(plans) != 1 || plans[0].Domain != "example.com" {
+				t.Fatalf("Plan() = %+v, want one plan for example.com", plans)
+			}
+
+			var plan, conflicts []string
+			for _, m := range plans[0].Plan {
+				plan = append(plan, fmt.Sprintf("%s %s %s %s", m.Action, m.Record.Name, m.Record.Type, m.Record.Data))
+			}
+			for _, r := range plans[0].Conflicts {
+				conflicts = append(conflicts, r.Name+" "+r.Type)
+			}
+			if !reflect.DeepEqual(plan, tt.wantPlan) {
+				t.Errorf("plan = %q, want %q", plan, tt.wantPlan)
+			}
+			if !reflect.DeepEqual(conflicts, tt.wantConflicts) {
+				t.Errorf("conflicts = %q, want %q", conflicts, tt.wantConflicts)
+			}
+		})
+	}
+}
+
+func TestPlanMissingDomain(t *testing.T) {
+	client := newTestClient(t, nil)
+	config := &Config{Domains: map[string]Domain{"example.com": {}}}
+	if _, err := Plan(client, config); err == nil {
+		t.Error("Plan() of a missing domain succeeded")
+	}
+}